@@ -0,0 +1,152 @@
+// Error type shared by the Splitwise and Lunch Money clients
+
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Services an Error can come from.
+const (
+	Splitwise  = "splitwise"
+	LunchMoney = "lunchmoney"
+)
+
+// maxBody caps how much of an error response is kept.
+const maxBody = 64 << 10
+
+// Error is an API answering with a failure: a non-2xx status, or a 2xx whose
+// body still lists errors, as Lunch Money does for rejected inserts. Use
+// errors.As to get at it through the clients' wrapping.
+type Error struct {
+	Service    string
+	Method     string
+	Endpoint   string // request path without the query string
+	StatusCode int
+	Body       string
+	// Errors are the messages the API listed, when the body has any.
+	Errors []string
+}
+
+// FromResponse builds an Error from a failed response, reading its body.
+func FromResponse(service string, resp *http.Response) *Error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxBody))
+
+	err := &Error{
+		Service:    service,
+		StatusCode: resp.StatusCode,
+		Body:       string(body),
+		Errors:     decodeMessages(body),
+	}
+	if resp.Request != nil {
+		err.Method = resp.Request.Method
+		err.Endpoint = resp.Request.URL.Path
+	}
+	return err
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s API error (status %d)", e.Service, e.StatusCode)
+	if e.Endpoint != "" {
+		fmt.Fprintf(&b, " on %s %s", e.Method, e.Endpoint)
+	}
+	switch {
+	case len(e.Errors) > 0:
+		fmt.Fprintf(&b, ": %s", strings.Join(e.Errors, "; "))
+	case e.Body != "":
+		fmt.Fprintf(&b, ": %s", e.Body)
+	}
+	return b.String()
+}
+
+// Retryable reports whether the same request may succeed later: rate
+// limiting, timeouts and server errors.
+func (e *Error) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests ||
+		e.StatusCode == http.StatusRequestTimeout ||
+		e.StatusCode >= 500
+}
+
+// Temporary is Retryable, under the name net.Error uses.
+func (e *Error) Temporary() bool {
+	return e.Retryable()
+}
+
+// Unauthorized reports whether the API rejected the token.
+func (e *Error) Unauthorized() bool {
+	return e.StatusCode == http.StatusUnauthorized
+}
+
+// IsUnauthorized reports whether err has an Error rejecting the token
+// anywhere in its chain.
+func IsUnauthorized(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Unauthorized()
+}
+
+// IsNotFound reports whether err has a 404 Error anywhere in its chain.
+func IsNotFound(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// decodeMessages pulls error messages out of a JSON body. Lunch Money sends
+// "error" as a string or a list; Splitwise sends "errors" as a map of field
+// to messages, or "error" as a string.
+func decodeMessages(body []byte) []string {
+	var envelope struct {
+		Error  json.RawMessage `json:"error"`
+		Errors json.RawMessage `json:"errors"`
+	}
+	if json.Unmarshal(body, &envelope) != nil {
+		return nil
+	}
+	return append(messages(envelope.Error), messages(envelope.Errors)...)
+}
+
+func messages(raw json.RawMessage) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var single string
+	if json.Unmarshal(raw, &single) == nil {
+		if single == "" {
+			return nil
+		}
+		return []string{single}
+	}
+
+	var list []string
+	if json.Unmarshal(raw, &list) == nil {
+		return list
+	}
+
+	var byField map[string]json.RawMessage
+	if json.Unmarshal(raw, &byField) == nil {
+		fields := make([]string, 0, len(byField))
+		for field := range byField {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		var all []string
+		for _, field := range fields {
+			for _, msg := range messages(byField[field]) {
+				if field != "base" {
+					msg = field + ": " + msg
+				}
+				all = append(all, msg)
+			}
+		}
+		return all
+	}
+	return nil
+}
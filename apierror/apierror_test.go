@@ -0,0 +1,143 @@
+package apierror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFromResponse(t *testing.T) {
+	tests := []struct {
+		name          string
+		statusCode    int
+		body          string
+		wantErrors    []string
+		wantRetryable bool
+		wantMessage   string
+	}{
+		{
+			name:        "lunch money error list",
+			statusCode:  http.StatusBadRequest,
+			body:        `{"error": ["Invalid date", "Missing amount"]}`,
+			wantErrors:  []string{"Invalid date", "Missing amount"},
+			wantMessage: "lunchmoney API error (status 400) on POST /v1/transactions: Invalid date; Missing amount",
+		},
+		{
+			name:        "lunch money error string",
+			statusCode:  http.StatusUnauthorized,
+			body:        `{"error": "Access token does not exist."}`,
+			wantErrors:  []string{"Access token does not exist."},
+			wantMessage: "lunchmoney API error (status 401) on POST /v1/transactions: Access token does not exist.",
+		},
+		{
+			name:        "splitwise errors by field",
+			statusCode:  http.StatusBadRequest,
+			body:        `{"errors": {"cost": ["must be positive"], "base": ["Invalid expense"]}}`,
+			wantErrors:  []string{"Invalid expense", "cost: must be positive"},
+			wantMessage: "lunchmoney API error (status 400) on POST /v1/transactions: Invalid expense; cost: must be positive",
+		},
+		{
+			name:          "plain text body",
+			statusCode:    http.StatusBadGateway,
+			body:          "Bad Gateway",
+			wantRetryable: true,
+			wantMessage:   "lunchmoney API error (status 502) on POST /v1/transactions: Bad Gateway",
+		},
+		{
+			name:          "rate limited",
+			statusCode:    http.StatusTooManyRequests,
+			wantRetryable: true,
+			wantMessage:   "lunchmoney API error (status 429) on POST /v1/transactions",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.statusCode)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			resp, err := http.Post(server.URL+"/v1/transactions?debit_as_negative=true", "application/json", strings.NewReader("{}"))
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			apiErr := FromResponse(LunchMoney, resp)
+
+			if apiErr.StatusCode != tt.statusCode {
+				t.Errorf("StatusCode = %d, want %d", apiErr.StatusCode, tt.statusCode)
+			}
+			if !slices.Equal(apiErr.Errors, tt.wantErrors) {
+				t.Errorf("Errors = %q, want %q", apiErr.Errors, tt.wantErrors)
+			}
+			if apiErr.Retryable() != tt.wantRetryable {
+				t.Errorf("Retryable() = %v, want %v", apiErr.Retryable(), tt.wantRetryable)
+			}
+			if apiErr.Error() != tt.wantMessage {
+				t.Errorf("Error() = %q, want %q", apiErr.Error(), tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestIsUnauthorized(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "401", err: &Error{StatusCode: http.StatusUnauthorized}, want: true},
+		{name: "wrapped 401", err: fmt.Errorf("fetching expenses: %w", &Error{StatusCode: http.StatusUnauthorized}), want: true},
+		{name: "403", err: &Error{StatusCode: http.StatusForbidden}, want: false},
+		{name: "not an API error", err: errors.New("connection refused"), want: false},
+		{name: "nil", err: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsUnauthorized(tt.err); got != tt.want {
+				t.Errorf("IsUnauthorized() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPartialError(t *testing.T) {
+	notFound := &Error{Service: Splitwise, StatusCode: http.StatusNotFound}
+	tests := []struct {
+		name    string
+		err     *PartialError
+		wantMsg string
+	}{
+		{
+			name:    "one expense",
+			err:     &PartialError{Op: "fetching comments", Failed: map[int64]error{2: notFound}, Total: 3},
+			wantMsg: "fetching comments failed for 1 of 3 expenses; expense 2: " + notFound.Error(),
+		},
+		{
+			name: "more than three expenses",
+			err: &PartialError{Op: "loading sync state", Failed: map[int64]error{
+				4: errors.New("d"), 1: errors.New("a"), 3: errors.New("c"), 2: notFound,
+			}, Total: 4},
+			wantMsg: "loading sync state failed for 4 of 4 expenses; expense 1: a; expense 2: " + notFound.Error() + "; expense 3: c; and 1 more",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.Error(); got != tt.wantMsg {
+				t.Errorf("Error() = %q, want %q", got, tt.wantMsg)
+			}
+			if !IsNotFound(tt.err) {
+				t.Errorf("IsNotFound() = false, want the expense's error reachable")
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+// Per-expense failures of calls that cover many expenses
+
+package apierror
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// PartialError names the expenses a call covering many expenses failed for.
+// Whatever it returned for every other expense is still good.
+type PartialError struct {
+	Op     string // what failed, e.g. "fetching comments"
+	Failed map[int64]error
+	Total  int
+}
+
+func (e *PartialError) Error() string {
+	ids := e.ExpenseIDs()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s failed for %d of %d expenses", e.Op, len(ids), e.Total)
+	for i, id := range ids {
+		if i == 3 {
+			fmt.Fprintf(&b, "; and %d more", len(ids)-i)
+			break
+		}
+		fmt.Fprintf(&b, "; expense %d: %v", id, e.Failed[id])
+	}
+	return b.String()
+}
+
+// Unwrap lets errors.As and errors.Is look at each expense's error.
+func (e *PartialError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failed))
+	for _, id := range e.ExpenseIDs() {
+		errs = append(errs, e.Failed[id])
+	}
+	return errs
+}
+
+// ExpenseIDs lists the failed expenses in order.
+func (e *PartialError) ExpenseIDs() []int64 {
+	ids := make([]int64, 0, len(e.Failed))
+	for id := range e.Failed {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
@@ -0,0 +1,78 @@
+// Local high-water mark for incremental syncs
+
+package checkpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Checkpoint records when the last fully successful sync cycle started.
+type Checkpoint struct {
+	LastSuccessfulSync time.Time `json:"last_successful_sync"`
+}
+
+// Load reads the checkpoint at path. A missing file is not an error; it
+// returns the zero Checkpoint, which means "fetch everything".
+func Load(path string) (Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Checkpoint{}, nil
+	}
+	if err != nil {
+		return Checkpoint{}, fmt.Errorf("reading checkpoint: %w", err)
+	}
+
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return Checkpoint{}, fmt.Errorf("decoding checkpoint %s: %w", path, err)
+	}
+	return cp, nil
+}
+
+// Save writes the checkpoint through a temp file and rename, so a crash
+// mid-write never leaves a truncated checkpoint behind.
+func Save(path string, cp Checkpoint) error {
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding checkpoint: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("writing checkpoint: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing checkpoint: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing checkpoint: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("writing checkpoint: %w", err)
+	}
+	return nil
+}
+
+// UpdatedAfter is the updated_after bound for the next fetch: the last
+// successful sync minus overlap, which absorbs clock skew between us and
+// Splitwise and expenses saved while the last cycle was running. It is zero
+// when there is no checkpoint yet.
+//
+// Back-dated expenses are still caught because Splitwise sets updated_at
+// when an expense is created, whatever its date.
+func (c Checkpoint) UpdatedAfter(overlap time.Duration) time.Time {
+	if c.LastSuccessfulSync.IsZero() {
+		return time.Time{}
+	}
+	return c.LastSuccessfulSync.Add(-overlap)
+}
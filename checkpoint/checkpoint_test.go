@@ -0,0 +1,85 @@
+package checkpoint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	cp, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() missing file error = %v", err)
+	}
+	if !cp.LastSuccessfulSync.IsZero() {
+		t.Errorf("Load() missing file = %v, want zero", cp.LastSuccessfulSync)
+	}
+
+	want := Checkpoint{LastSuccessfulSync: time.Date(2025, 12, 1, 8, 30, 0, 0, time.UTC)}
+	if err := Save(path, want); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	got, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !got.LastSuccessfulSync.Equal(want.LastSuccessfulSync) {
+		t.Errorf("Load() = %v, want %v", got.LastSuccessfulSync, want.LastSuccessfulSync)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Save() left %d files behind, want 1", len(entries))
+	}
+}
+
+func TestLoadCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(path); err == nil {
+		t.Error("Load() corrupt file expected error, got none")
+	}
+}
+
+func TestUpdatedAfter(t *testing.T) {
+	last := time.Date(2025, 12, 1, 8, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		cp      Checkpoint
+		overlap time.Duration
+		want    time.Time
+	}{
+		{
+			name:    "no checkpoint fetches everything",
+			cp:      Checkpoint{},
+			overlap: time.Hour,
+			want:    time.Time{},
+		},
+		{
+			name:    "overlap is subtracted",
+			cp:      Checkpoint{LastSuccessfulSync: last},
+			overlap: time.Hour,
+			want:    last.Add(-time.Hour),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.cp.UpdatedAfter(tt.overlap)
+			if !got.Equal(tt.want) {
+				t.Errorf("UpdatedAfter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
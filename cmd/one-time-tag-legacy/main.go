@@ -1,9 +1,103 @@
-// migration script
+// one-time-tag-legacy marks every existing expense with the friend as
+// legacy by commenting the legacy tag on it, so the first sync leaves years
+// of history out of Lunch Money. Run it once before the first sync. It can be
+// stopped and run again: expenses that already carry the tag, or that the
+// sync already handled, are never tagged.
+package main
 
-package main 
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-import "fmt"
+	"github.com/jasmineyas/splitwise-lunchmoney/config"
+	"github.com/jasmineyas/splitwise-lunchmoney/detector"
+	"github.com/jasmineyas/splitwise-lunchmoney/logging"
+	"github.com/jasmineyas/splitwise-lunchmoney/splitwise"
+)
 
-func main(){
-	fmt.Println("Hello, tagging script!")
-}
\ No newline at end of file
+func main() {
+	before := flag.String("before", "", "only tag expenses dated before this day, YYYY-MM-DD (default every existing expense)")
+	dryRun := flag.Bool("dry-run", false, "list the expenses that would be tagged without commenting")
+	progressFile := flag.String("progress", defaultProgressFile, "file recording tagged expenses, so an interrupted run can resume")
+	configFile := flag.String("config", "", "JSON config file; environment variables override it (default CONFIG_FILE)")
+	flag.Parse()
+
+	logger := logging.New(os.Stdout)
+
+	var cutoff time.Time
+	if *before != "" {
+		var err error
+		cutoff, err = time.Parse(time.DateOnly, *before)
+		if err != nil {
+			logger.Error("Invalid -before date; want YYYY-MM-DD", "before", *before)
+			os.Exit(2)
+		}
+	}
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		logger.Error("Error loading config", "error", err)
+		os.Exit(1)
+	}
+	if err := config.Validate(cfg); err != nil {
+		logger.Error("Invalid config", "error", err)
+		os.Exit(1)
+	}
+	logger = logging.New(os.Stdout, cfg.Secrets()...)
+
+	progress, err := loadProgress(*progressFile, cfg.Comments.LegacyTag)
+	if err != nil {
+		logger.Error("Error loading progress", "error", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	swClient := splitwise.NewClient(cfg.SplitwiseBearerToken, splitwise.WithRateLimit(cfg.SplitwiseRateLimit, splitwise.DefaultRateBurst))
+
+	filter := splitwise.ExpenseFilter{FriendID: cfg.UserBSplitwiseID}
+	if !cutoff.IsZero() {
+		filter.DatedBefore = cutoff.Format(time.DateOnly)
+	}
+	expenses, err := swClient.GetAllExpensesContext(ctx, filter)
+	if err != nil {
+		logger.Error("Error fetching expenses with friend", "error", err)
+		os.Exit(1)
+	}
+	logger.Info("Fetched expenses with friend", "count", len(expenses), "before", *before, "dry_run", *dryRun)
+
+	t := &tagger{
+		client:       swClient,
+		opts:         detector.NewOptions(cfg.Comments, 0),
+		workers:      cfg.CommentWorkers,
+		before:       cutoff,
+		dryRun:       *dryRun,
+		progress:     progress,
+		progressPath: *progressFile,
+		logger:       logger,
+	}
+	sum, err := t.run(ctx, expenses)
+	logger.Info("Legacy tagging finished",
+		"tag", cfg.Comments.LegacyTag,
+		"tagged", sum.Tagged,
+		"already_tagged", sum.AlreadyTagged,
+		"synced", sum.Synced,
+		"skipped", sum.Skipped,
+		"failed", sum.Failed,
+		"interrupted", sum.Interrupted,
+		"dry_run", *dryRun,
+	)
+	if err != nil {
+		logger.Error("Some expenses were not tagged; run again to retry them", "error", err)
+		os.Exit(1)
+	}
+	if sum.Interrupted > 0 {
+		logger.Info("Interrupted; run again to continue", "progress", *progressFile)
+		os.Exit(1)
+	}
+}
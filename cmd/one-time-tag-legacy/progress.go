@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// defaultProgressFile is where a run records what it tagged.
+const defaultProgressFile = "legacy-tag-progress.json"
+
+// progress lists the expenses already tagged, so an interrupted run picks up
+// where it stopped. The comments would stop a second tag on their own, but
+// reading them again for every tagged expense is what the file saves.
+type progress struct {
+	LegacyTag string  `json:"legacy_tag"`
+	Tagged    []int64 `json:"tagged"`
+
+	tagged map[int64]bool
+}
+
+// loadProgress reads the progress file at path. A missing file means nothing
+// has been tagged yet.
+func loadProgress(path, legacyTag string) (*progress, error) {
+	p := &progress{LegacyTag: legacyTag, tagged: make(map[int64]bool)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading progress file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("decoding progress file %s: %w", path, err)
+	}
+	if p.LegacyTag != legacyTag {
+		return nil, fmt.Errorf("progress file %s is for legacy tag %q, not %q; use another -progress file", path, p.LegacyTag, legacyTag)
+	}
+	for _, id := range p.Tagged {
+		p.tagged[id] = true
+	}
+	return p, nil
+}
+
+func (p *progress) done(expenseID int64) bool {
+	return p.tagged[expenseID]
+}
+
+func (p *progress) add(expenseID int64) {
+	if p.tagged[expenseID] {
+		return
+	}
+	p.tagged[expenseID] = true
+	p.Tagged = append(p.Tagged, expenseID)
+	slices.Sort(p.Tagged)
+}
+
+// save writes the progress through a temp file and rename, so a crash
+// mid-write never loses what was already recorded.
+func (p *progress) save(path string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding progress: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("writing progress file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing progress file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing progress file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("writing progress file: %w", err)
+	}
+	return nil
+}
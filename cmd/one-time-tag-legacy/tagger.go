@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jasmineyas/splitwise-lunchmoney/apierror"
+	"github.com/jasmineyas/splitwise-lunchmoney/detector"
+	"github.com/jasmineyas/splitwise-lunchmoney/models"
+	"github.com/jasmineyas/splitwise-lunchmoney/state"
+)
+
+// tagger posts the legacy tag on expenses that don't have it yet.
+type tagger struct {
+	client       state.CommentAPI
+	opts         detector.Options
+	workers      int
+	before       time.Time // zero tags every expense
+	dryRun       bool
+	progress     *progress
+	progressPath string
+	logger       *slog.Logger
+}
+
+// summary counts what happened to each expense fetched.
+type summary struct {
+	Tagged        int // tag posted, or would be in a dry run
+	AlreadyTagged int
+	Synced        int // has sync state, so it's no longer legacy
+	Skipped       int // deleted, or not before the cutoff
+	Failed        int
+	Interrupted   int // not reached because ctx was cancelled
+}
+
+// run tags every expense that needs it. Failures on single expenses are
+// counted and returned together at the end; a rejected token or a progress
+// file that can't be written stops the run, since carrying on would fail the
+// same way or lose track of what was tagged.
+func (t *tagger) run(ctx context.Context, expenses []models.SplitwiseExpense) (summary, error) {
+	var sum summary
+
+	var candidates []int64
+	for _, expense := range expenses {
+		switch {
+		case expense.DeletedAt != nil, !t.before.IsZero() && !expense.Date.Before(t.before):
+			sum.Skipped++
+		case t.progress.done(expense.ID):
+			sum.AlreadyTagged++
+		default:
+			candidates = append(candidates, expense.ID)
+		}
+	}
+	if len(candidates) == 0 {
+		return sum, nil
+	}
+
+	user, err := t.client.GetUserInfoContext(ctx)
+	if err != nil {
+		return sum, fmt.Errorf("looking up the sync user: %w", err)
+	}
+	t.opts.SyncUserID = user.ID
+
+	comments, err := t.client.GetCommentsForExpensesContext(ctx, candidates, t.workers)
+	failed := make(map[int64]error)
+	var fetchErr *apierror.PartialError
+	switch {
+	case apierror.IsUnauthorized(err):
+		return sum, err
+	case errors.As(err, &fetchErr):
+		failed = fetchErr.Failed
+	case err != nil:
+		return sum, err
+	}
+
+	var errs []error
+	for i, id := range candidates {
+		if ctx.Err() != nil {
+			sum.Interrupted += len(candidates) - i
+			break
+		}
+
+		if err := failed[id]; err != nil {
+			sum.Failed++
+			errs = append(errs, fmt.Errorf("expense %d: reading comments: %w", id, err))
+			continue
+		}
+
+		expenseState, err := detector.StateFromComments(comments[id], t.opts)
+		switch {
+		case err != nil:
+			sum.Failed++
+			errs = append(errs, fmt.Errorf("expense %d: %w", id, err))
+			continue
+		case expenseState.Legacy:
+			sum.AlreadyTagged++
+			if err := t.record(id); err != nil {
+				return sum, err
+			}
+			continue
+		case expenseState.Sync != nil || expenseState.Deletion != nil:
+			// the tag would hide it from the sync that already owns it
+			sum.Synced++
+			continue
+		}
+
+		if t.dryRun {
+			t.logger.Info("Would tag expense", "expense_id", id)
+			sum.Tagged++
+			continue
+		}
+
+		if err := t.client.AddCommentToExpenseContext(ctx, id, t.opts.LegacyTag); err != nil {
+			if apierror.IsUnauthorized(err) {
+				return sum, err
+			}
+			sum.Failed++
+			errs = append(errs, fmt.Errorf("expense %d: posting legacy tag: %w", id, err))
+			continue
+		}
+		sum.Tagged++
+		if err := t.record(id); err != nil {
+			return sum, err
+		}
+	}
+
+	return sum, errors.Join(errs...)
+}
+
+// record saves that an expense carries the tag. Dry runs write nothing.
+func (t *tagger) record(expenseID int64) error {
+	if t.dryRun {
+		return nil
+	}
+	t.progress.add(expenseID)
+	return t.progress.save(t.progressPath)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jasmineyas/splitwise-lunchmoney/apierror"
+	"github.com/jasmineyas/splitwise-lunchmoney/detector"
+	"github.com/jasmineyas/splitwise-lunchmoney/models"
+	"github.com/jasmineyas/splitwise-lunchmoney/syncEngine/fake"
+)
+
+const (
+	syncUserID = 9792490
+	legacyTag  = "pre-SW-LM-handshake"
+)
+
+func newTagger(t *testing.T, client *fake.Splitwise, dryRun bool) *tagger {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "progress.json")
+	progress, err := loadProgress(path, legacyTag)
+	if err != nil {
+		t.Fatalf("loadProgress() error = %v", err)
+	}
+	return &tagger{
+		client:       client,
+		opts:         detector.Options{LegacyTag: legacyTag},
+		workers:      1,
+		before:       time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		dryRun:       dryRun,
+		progress:     progress,
+		progressPath: path,
+		logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
+
+// legacyExpenses covers every case: 1 and 2 need tagging, 3 is tagged, 4 was
+// synced, 5 is deleted and 6 is after the cutoff.
+func legacyExpenses(t *testing.T, client *fake.Splitwise) []models.SplitwiseExpense {
+	t.Helper()
+	old := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	deletedAt := old
+
+	if err := client.AddCommentToExpenseContext(context.Background(), 3, legacyTag); err != nil {
+		t.Fatal(err)
+	}
+	syncComment, err := detector.EncodeSyncComment(models.SyncMetadata{SplitwiseExpenseID: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.AddCommentToExpenseContext(context.Background(), 4, syncComment); err != nil {
+		t.Fatal(err)
+	}
+
+	return []models.SplitwiseExpense{
+		{ID: 1, Date: old},
+		{ID: 2, Date: old},
+		{ID: 3, Date: old},
+		{ID: 4, Date: old},
+		{ID: 5, Date: old, DeletedAt: &deletedAt},
+		{ID: 6, Date: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}
+}
+
+func legacyTagCount(client *fake.Splitwise, expenseID int64) int {
+	count := 0
+	for _, comment := range client.CommentsOn(expenseID) {
+		if comment.Content == legacyTag {
+			count++
+		}
+	}
+	return count
+}
+
+func TestTaggerTagsOnce(t *testing.T) {
+	client := fake.NewSplitwise(syncUserID)
+	expenses := legacyExpenses(t, client)
+	tg := newTagger(t, client, false)
+
+	sum, err := tg.run(context.Background(), expenses)
+	if err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	want := summary{Tagged: 2, AlreadyTagged: 1, Synced: 1, Skipped: 2}
+	if sum != want {
+		t.Errorf("run() = %+v, want %+v", sum, want)
+	}
+
+	// a second run resumes from the progress file and tags nothing again
+	progress, err := loadProgress(tg.progressPath, legacyTag)
+	if err != nil {
+		t.Fatalf("loadProgress() error = %v", err)
+	}
+	tg.progress = progress
+	sum, err = tg.run(context.Background(), expenses)
+	if err != nil {
+		t.Fatalf("second run() error = %v", err)
+	}
+	want = summary{AlreadyTagged: 3, Synced: 1, Skipped: 2}
+	if sum != want {
+		t.Errorf("second run() = %+v, want %+v", sum, want)
+	}
+
+	for id, wantTags := range map[int64]int{1: 1, 2: 1, 3: 1, 4: 0, 5: 0, 6: 0} {
+		if got := legacyTagCount(client, id); got != wantTags {
+			t.Errorf("expense %d has %d legacy tags, want %d", id, got, wantTags)
+		}
+	}
+}
+
+func TestTaggerDryRun(t *testing.T) {
+	client := fake.NewSplitwise(syncUserID)
+	expenses := legacyExpenses(t, client)
+	tg := newTagger(t, client, true)
+
+	sum, err := tg.run(context.Background(), expenses)
+	if err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if sum.Tagged != 2 {
+		t.Errorf("run() tagged = %d, want 2", sum.Tagged)
+	}
+	for _, id := range []int64{1, 2} {
+		if got := legacyTagCount(client, id); got != 0 {
+			t.Errorf("dry run posted %d legacy tags on expense %d", got, id)
+		}
+	}
+	if _, err := os.Stat(tg.progressPath); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("dry run wrote a progress file: stat error = %v", err)
+	}
+}
+
+func TestTaggerStopsOnRejectedToken(t *testing.T) {
+	client := fake.NewSplitwise(syncUserID)
+	expenses := legacyExpenses(t, client)
+	client.Errs["AddCommentToExpense"] = &apierror.Error{Service: apierror.Splitwise, StatusCode: http.StatusUnauthorized}
+	tg := newTagger(t, client, false)
+
+	sum, err := tg.run(context.Background(), expenses)
+	if !apierror.IsUnauthorized(err) {
+		t.Fatalf("run() error = %v, want unauthorized", err)
+	}
+	if sum.Tagged != 0 || sum.Failed != 0 {
+		t.Errorf("run() = %+v, want it to stop before counting anything", sum)
+	}
+}
+
+func TestLoadProgressOtherTag(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "progress.json")
+	progress, err := loadProgress(path, legacyTag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	progress.add(1)
+	if err := progress.save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadProgress(path, legacyTag+"-test"); err == nil {
+		t.Error("expected error loading progress written for another tag, got nil")
+	}
+}
@@ -0,0 +1,71 @@
+// rebuild-state reads the sync comments on every expense with the friend
+// and writes them to the local state file, so STATE_STORE=file can take over
+// from comments. Run it again whenever the file is lost or stale.
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/jasmineyas/splitwise-lunchmoney/config"
+	"github.com/jasmineyas/splitwise-lunchmoney/detector"
+	"github.com/jasmineyas/splitwise-lunchmoney/logging"
+	"github.com/jasmineyas/splitwise-lunchmoney/splitwise"
+	"github.com/jasmineyas/splitwise-lunchmoney/state"
+)
+
+func main() {
+	output := flag.String("output", "", "state file to write (default STATE_FILE or sync_state.json)")
+	configFile := flag.String("config", "", "JSON config file; environment variables override it (default CONFIG_FILE)")
+	flag.Parse()
+
+	logger := logging.New(os.Stdout)
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		logger.Error("Error loading config", "error", err)
+		os.Exit(1)
+	}
+	if *output != "" {
+		cfg.StateFile = *output
+	}
+	if err := config.Validate(cfg); err != nil {
+		logger.Error("Invalid config", "error", err)
+		os.Exit(1)
+	}
+	logger = logging.New(os.Stdout, cfg.Secrets()...)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	swClient := splitwise.NewClient(cfg.SplitwiseBearerToken, splitwise.WithRateLimit(cfg.SplitwiseRateLimit, splitwise.DefaultRateBurst))
+
+	expenses, err := swClient.GetAllExpensesContext(ctx, splitwise.ExpenseFilter{FriendID: cfg.UserBSplitwiseID})
+	if err != nil {
+		logger.Error("Error fetching expenses with friend", "error", err)
+		os.Exit(1)
+	}
+	logger.Info("Fetched expenses with friend", "count", len(expenses))
+
+	expenseIDs := make([]int64, len(expenses))
+	for i, expense := range expenses {
+		expenseIDs[i] = expense.ID
+	}
+
+	states, err := state.NewCommentStore(swClient, cfg.CommentWorkers, detector.NewOptions(cfg.Comments, 0)).Load(ctx, expenseIDs)
+	if err != nil {
+		// a file missing any synced expense would have it created twice, so
+		// nothing is written unless every expense was read
+		logger.Error("Error reading sync comments; state file not written", "error", err)
+		os.Exit(1)
+	}
+
+	if _, err := state.CreateFileStore(cfg.StateFile, states); err != nil {
+		logger.Error("Error writing state file", "error", err)
+		os.Exit(1)
+	}
+	logger.Info("State file rebuilt", "path", cfg.StateFile, "expenses", len(expenses), "recorded", len(states))
+}
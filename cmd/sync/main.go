@@ -1,73 +1,379 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log/slog"
+	"math/rand/v2"
 	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
+	"github.com/jasmineyas/splitwise-lunchmoney/apierror"
+	"github.com/jasmineyas/splitwise-lunchmoney/checkpoint"
 	"github.com/jasmineyas/splitwise-lunchmoney/config"
 	"github.com/jasmineyas/splitwise-lunchmoney/detector"
+	"github.com/jasmineyas/splitwise-lunchmoney/logging"
 	"github.com/jasmineyas/splitwise-lunchmoney/lunchmoney"
 	"github.com/jasmineyas/splitwise-lunchmoney/models"
+	"github.com/jasmineyas/splitwise-lunchmoney/preflight"
 	"github.com/jasmineyas/splitwise-lunchmoney/splitwise"
+	"github.com/jasmineyas/splitwise-lunchmoney/state"
 	syncengine "github.com/jasmineyas/splitwise-lunchmoney/syncEngine"
 )
 
+// jitterFraction spreads daemon cycles by up to ±10% of the interval so
+// several instances don't hit Splitwise at the same moment.
+const jitterFraction = 0.1
+
 func main() {
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	plan := flag.Bool("plan", false, "print what would be synced without writing to Splitwise or Lunch Money")
+	planJSON := flag.Bool("plan-json", false, "like -plan, but print the plan as JSON")
+	daemon := flag.Bool("daemon", false, "keep running and sync every -interval")
+	interval := flag.Duration("interval", 0, "time between syncs in daemon mode (default SYNC_INTERVAL or 15m)")
+	configFile := flag.String("config", "", "JSON config file; environment variables override it (default CONFIG_FILE)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [doctor]\n\ndoctor checks the tokens, friend and assets in the config, then exits.\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	planMode := *plan || *planJSON
+
+	doctor := false
+	switch flag.Arg(0) {
+	case "":
+	case "doctor":
+		doctor = true
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", flag.Arg(0))
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	logOutput := os.Stdout
+	if planMode || doctor {
+		// keep stdout for the plan or report so it can be piped
+		logOutput = os.Stderr
+	}
+	logger := logging.New(logOutput)
 	logger.Info("Starting Splitwise-LunchMoney Sync")
 
-	cfg, err := config.Load()
+	// config problems go to stderr whatever the mode, and fail the run
+	errLogger := logging.New(os.Stderr)
+	cfg, err := config.Load(*configFile)
 	if err != nil {
-		fmt.Printf("Error loading config: %v\n", err)
-		return
+		errLogger.Error("Error loading config", "error", err)
+		os.Exit(1)
+	}
+	if *interval > 0 {
+		cfg.SyncInterval = *interval
+	}
+	if err := config.Validate(cfg); err != nil {
+		errLogger.Error("Invalid config", "error", err)
+		os.Exit(1)
 	}
+	logger = logging.New(logOutput, cfg.Secrets()...)
 
 	logger.Info("Config loaded successfully", "config", cfg)
 
+	// SIGINT/SIGTERM let the expense in flight finish, then stop
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// initialize clients and sync engine here
-	swClient := splitwise.NewClient(cfg.SplitwiseBearerToken)
-	lmClient := lunchmoney.NewClient(cfg.UserALunchMoney.BearerToken)
-	engine := syncengine.New(swClient, lmClient, cfg)
+	swClient := splitwise.NewClient(cfg.SplitwiseBearerToken, splitwise.WithRateLimit(cfg.SplitwiseRateLimit, splitwise.DefaultRateBurst))
+	lmClientA := lunchmoney.NewClient(cfg.UserALunchMoney.BearerToken)
+	lmClientB := lunchmoney.NewClient(cfg.UserBLunchMoney.BearerToken)
 
-	// wrap everything in a loop
+	report := preflight.Run(ctx, cfg, swClient, lmClientA, lmClientB)
+	if doctor {
+		printReport(os.Stdout, report)
+		if report.Err() != nil {
+			os.Exit(1)
+		}
+		return
+	}
+	if report.Err() != nil {
+		for _, check := range report.Checks {
+			if check.Err != nil {
+				logger.Error("Preflight check failed", "check", check.Name, "error", check.Err)
+			}
+		}
+		logger.Error("Stopping before syncing; fix the setup above, or run the doctor command to recheck it")
+		os.Exit(1)
+	}
+	logger.Info("Preflight passed", "user", report.User.ID, "friend", report.Friend.ID)
 
-	// 1. fetch data - all expenses and associated comments with a friend
-	// we will update the date later
-	expenses, err := swClient.GetAllExpenses(cfg.UserBSplitwiseID, "")
+	store, err := openStore(cfg, swClient, report.User.ID)
 	if err != nil {
-		logger.Error("Error fetching expenses with friend", "error", err)
+		logger.Error("Error opening state store", "error", err)
+		os.Exit(1)
+	}
+	engine := syncengine.New(swClient, lmClientA, lmClientB, cfg, syncengine.WithStore(store), syncengine.WithCurrentUser(report.User.ID))
+
+	if planMode {
+		runPlan(ctx, logger, swClient, store, engine, cfg, *planJSON)
 		return
 	}
 
-	logger.Info("Fetched expenses with friend", "count", len(expenses))
-	commentsMap := make(map[int64][]models.SplitwiseComment)
-	for _, expense := range expenses {
-		comments, err := swClient.GetExpenseComments(expense.ID)
+	if !*daemon {
+		// runCycle already logged the error; the exit code tells cron or CI
+		if err := runCycle(ctx, logger, swClient, store, engine, cfg); err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
+	logger.Info("Running in daemon mode", "interval", cfg.SyncInterval.String())
+	for {
+		if err := runCycle(ctx, logger, swClient, store, engine, cfg); tokenRejected(err) {
+			// every later cycle would fail the same way
+			logger.Error("Stopping: an API token was rejected; replace it and restart")
+			os.Exit(1)
+		}
+
+		wait := jitter(cfg.SyncInterval)
+		logger.Info("Next sync scheduled", "in", wait.Round(time.Second).String())
+
+		select {
+		case <-ctx.Done():
+			logger.Info("Shutting down")
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// runCycle does one fetch, detect and sync pass and logs a summary line. It
+// never panics or exits, so a bad cycle doesn't take the daemon down; the
+// error it logged is returned.
+func runCycle(ctx context.Context, logger *slog.Logger, swClient *splitwise.Client, store state.Store, engine *syncengine.Engine, cfg *config.Config) (err error) {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, cfg.SyncTimeout)
+	defer cancel()
+
+	limitBefore := swClient.RateLimitStats()
+	var result syncengine.Result
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("sync cycle panicked: %v", r)
+		}
+
+		limitAfter := swClient.RateLimitStats()
+		attrs := []any{
+			"duration", time.Since(start).Round(time.Millisecond).String(),
+			"splitwiseRequests", limitAfter.Requests - limitBefore.Requests,
+			"splitwiseRateLimited", (limitAfter.Waited - limitBefore.Waited).Round(time.Millisecond).String(),
+			"splitwiseThrottled", limitAfter.Throttled - limitBefore.Throttled,
+			"created", result.Created,
+			"updated", result.Updated,
+			"deleted", result.Deleted,
+			"failed", result.Failed,
+			"interrupted", result.Interrupted,
+		}
 		if err != nil {
-			logger.Error("Error fetching comments for expense", "expenseID", expense.ID, "error", err)
+			logger.Error("Sync cycle finished with errors", append(attrs, "error", err)...)
 			return
 		}
-		commentsMap[expense.ID] = comments
+		logger.Info("Sync cycle finished", attrs...)
+	}()
+
+	changes, err := detect(ctx, logger, swClient, store, cfg)
+	if err != nil {
+		return err
 	}
 
-	logger.Info("Fetched comments for expenses", "count", len(commentsMap))
+	// 3. execute sync data
+	result, err = engine.Sync(ctx, changes.toCreate, changes.toUpdate, changes.toDelete)
 
-	// 2. detect changes
-	toCreate, err := detector.DetectChanges(expenses, commentsMap)
+	// the cycle's start, not its end: expenses edited while it ran are
+	// picked up next time
+	next := start
+	unfinished := append(slices.Clone(changes.skipped), result.Unfinished...)
+	if len(unfinished) > 0 {
+		// anything left over has to be fetched again next cycle, so stop
+		// just short of the oldest; the rest still moves on
+		oldest, ok := changes.oldestUpdate(unfinished)
+		if !ok {
+			logger.Warn("Checkpoint not advanced, an unfinished expense has no update time", "unfinished", len(unfinished))
+			return err
+		}
+		if held := oldest.Add(-time.Second); held.Before(next) {
+			next = held
+		}
+		logger.Warn("Checkpoint held back for unfinished expenses", "unfinished", len(unfinished), "checkpoint", next)
+	} else if err != nil {
+		logger.Warn("Checkpoint not advanced after sync errors")
+		return err
+	}
+
+	if saveErr := checkpoint.Save(cfg.CheckpointFile, checkpoint.Checkpoint{LastSuccessfulSync: next}); saveErr != nil {
+		return errors.Join(err, fmt.Errorf("saving checkpoint: %w", saveErr))
+	}
+	return err
+}
+
+// tokenRejected reports whether err came from an API refusing a token,
+// during detection or sync.
+func tokenRejected(err error) bool {
+	return errors.Is(err, syncengine.ErrTokenRejected) || apierror.IsUnauthorized(err)
+}
+
+func runPlan(ctx context.Context, logger *slog.Logger, swClient *splitwise.Client, store state.Store, engine *syncengine.Engine, cfg *config.Config, asJSON bool) {
+	changes, err := detect(ctx, logger, swClient, store, cfg)
 	if err != nil {
 		logger.Error("Error detecting changes", "error", err)
 		return
 	}
-	logger.Info("Detected changes", "toCreate", len(toCreate))
 
-	// 3. execute sync data
-	err = engine.Sync(toCreate, []models.UpdateAction{}, []models.DeleteAction{})
+	syncPlan, err := engine.Plan(ctx, changes.toCreate, changes.toUpdate, changes.toDelete)
 	if err != nil {
-		logger.Error("Error syncing data", "error", err)
+		logger.Error("Error building plan", "error", err)
 		return
 	}
 
-	logger.Info("Sync completed successfully")
+	if asJSON {
+		err = syncPlan.WriteJSON(os.Stdout)
+	} else {
+		err = syncPlan.WriteText(os.Stdout)
+	}
+	if err != nil {
+		logger.Error("Error writing plan", "error", err)
+	}
+}
+
+// changes is what one cycle has to sync.
+type changes struct {
+	toCreate []models.SplitwiseExpense
+	toUpdate []models.UpdateAction
+	toDelete []models.DeleteAction
+
+	// updatedAt is when each fetched expense last changed, and skipped the
+	// ones whose sync state couldn't be loaded or didn't fit them. The
+	// checkpoint must not move past skipped or unfinished expenses.
+	updatedAt map[int64]time.Time
+	skipped   []int64
+}
+
+// oldestUpdate is the earliest update time among expenseIDs. ok is false if
+// any of them wasn't fetched this cycle or has no update time.
+func (c changes) oldestUpdate(expenseIDs []int64) (oldest time.Time, ok bool) {
+	for i, id := range expenseIDs {
+		updatedAt := c.updatedAt[id]
+		if updatedAt.IsZero() {
+			return time.Time{}, false
+		}
+		if i == 0 || updatedAt.Before(oldest) {
+			oldest = updatedAt
+		}
+	}
+	return oldest, true
+}
+
+// detect fetches expenses changed since the checkpoint, plus their sync
+// state, and works out what needs syncing. Without a checkpoint it looks at
+// every expense with the friend.
+func detect(ctx context.Context, logger *slog.Logger, swClient *splitwise.Client, store state.Store, cfg *config.Config) (changes, error) {
+	cp, err := checkpoint.Load(cfg.CheckpointFile)
+	if err != nil {
+		return changes{}, err
+	}
+
+	// 1. fetch data - expenses with the friend and their sync state
+	filter := splitwise.ExpenseFilter{
+		FriendID:     cfg.UserBSplitwiseID,
+		UpdatedAfter: cp.UpdatedAfter(cfg.CheckpointOverlap),
+	}
+	expenses, err := swClient.GetAllExpensesContext(ctx, filter)
+	if err != nil {
+		return changes{}, fmt.Errorf("fetching expenses with friend: %w", err)
+	}
+
+	logger.Info("Fetched expenses with friend", "count", len(expenses), "updatedAfter", filter.UpdatedAfter)
+
+	expenseIDs := make([]int64, len(expenses))
+	result := changes{updatedAt: make(map[int64]time.Time, len(expenses))}
+	for i, expense := range expenses {
+		expenseIDs[i] = expense.ID
+		result.updatedAt[expense.ID] = expense.UpdatedAt
+	}
+	states, err := store.Load(ctx, expenseIDs)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return changes{}, ctxErr
+	}
+
+	var loadErr *apierror.PartialError
+	switch {
+	case apierror.IsUnauthorized(err):
+		return changes{}, err
+	case errors.As(err, &loadErr):
+		// without its state an expense looks unsynced and would be created
+		// twice; leave it for the next cycle
+		logger.Warn("Skipping expenses whose sync state couldn't be loaded", "count", len(loadErr.Failed), "error", err)
+		expenses = slices.DeleteFunc(expenses, func(expense models.SplitwiseExpense) bool {
+			_, failed := loadErr.Failed[expense.ID]
+			return failed
+		})
+		for id := range loadErr.Failed {
+			result.skipped = append(result.skipped, id)
+		}
+	case err != nil:
+		return changes{}, err
+	}
+
+	logger.Info("Loaded sync state for expenses", "store", cfg.StateStore, "synced", len(states))
+
+	// 2. detect changes
+	result.toCreate, result.toUpdate, result.toDelete, err = detector.DetectFromState(ctx, expenses, states)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return changes{}, ctxErr
+	}
+	if err != nil {
+		// only the expenses whose state doesn't fit them are left out; they
+		// hold the checkpoint back so they're checked again every cycle
+		// until the state is fixed by hand
+		skipped, ok := detector.SkippedExpenses(err)
+		if !ok {
+			return changes{}, err
+		}
+		logger.Warn("Some expenses were skipped during change detection and will be retried", "count", len(skipped), "error", err)
+		result.skipped = append(result.skipped, skipped...)
+	}
+	logger.Info("Detected changes", "toCreate", len(result.toCreate), "toUpdate", len(result.toUpdate), "toDelete", len(result.toDelete))
+
+	return result, nil
+}
+
+// openStore returns the state store cfg asks for.
+func openStore(cfg *config.Config, swClient *splitwise.Client, syncUserID int64) (state.Store, error) {
+	if cfg.StateStore == config.StateStoreFile {
+		return state.OpenFileStore(cfg.StateFile)
+	}
+	return state.NewCommentStore(swClient, cfg.CommentWorkers, detector.NewOptions(cfg.Comments, syncUserID)), nil
+}
+
+// printReport writes one line per preflight check.
+func printReport(w io.Writer, report preflight.Report) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, check := range report.Checks {
+		if check.Err != nil {
+			fmt.Fprintf(tw, "FAIL\t%s\t%v\n", check.Name, check.Err)
+		} else {
+			fmt.Fprintf(tw, "ok\t%s\t%s\n", check.Name, check.Detail)
+		}
+	}
+	tw.Flush()
+}
 
+// jitter returns interval shifted randomly by up to jitterFraction either way.
+func jitter(interval time.Duration) time.Duration {
+	spread := float64(interval) * jitterFraction
+	return interval + time.Duration((rand.Float64()*2-1)*spread)
 }
@@ -0,0 +1,53 @@
+package config
+
+// testSuffix is appended to every default marker and tag in test mode, so a
+// test run never reads, overwrites or tags anything a production run did.
+const testSuffix = "-test"
+
+// CommentConfig names the Splitwise comments the sync reads and writes.
+type CommentConfig struct {
+	SyncMarker     string `json:"sync_marker"`     // first word of sync comments
+	DeletionMarker string `json:"deletion_marker"` // first word of deletion comments
+	LegacyTag      string `json:"legacy_tag"`      // whole comment on pre-sync expenses
+}
+
+// DefaultCommentConfig matches the detector's defaults in production and
+// suffixes them in test mode.
+func DefaultCommentConfig(testMode bool) CommentConfig {
+	cfg := CommentConfig{
+		SyncMarker:     "Synced-to-LM",
+		DeletionMarker: "Deleted-from-LM",
+		LegacyTag:      "pre-SW-LM-handshake",
+	}
+	if testMode {
+		cfg.SyncMarker += testSuffix
+		cfg.DeletionMarker += testSuffix
+		cfg.LegacyTag += testSuffix
+	}
+	return cfg
+}
+
+// fillModeDefaults sets every marker and tag the file and environment left
+// empty to the default for the configured mode, and the external ID suffix
+// regardless. It runs last because TestMode itself can come from either.
+func (c *Config) fillModeDefaults() {
+	comments := DefaultCommentConfig(c.TestMode)
+	orDefault(&c.Comments.SyncMarker, comments.SyncMarker)
+	orDefault(&c.Comments.DeletionMarker, comments.DeletionMarker)
+	orDefault(&c.Comments.LegacyTag, comments.LegacyTag)
+
+	transactions := DefaultTransactionConfig(c.TestMode)
+	orDefault(&c.Transactions.Status, transactions.Status)
+	orDefault(&c.Transactions.NotesTemplate, transactions.NotesTemplate)
+	orDefault(&c.Transactions.Tags.Sync, transactions.Tags.Sync)
+	orDefault(&c.Transactions.Tags.Reimbursement, transactions.Tags.Reimbursement)
+	orDefault(&c.Transactions.Tags.Payment, transactions.Tags.Payment)
+	orDefault(&c.Transactions.Tags.Deleted, transactions.Tags.Deleted)
+	c.Transactions.ExternalIDSuffix = transactions.ExternalIDSuffix
+}
+
+func orDefault(dst *string, fallback string) {
+	if *dst == "" {
+		*dst = fallback
+	}
+}
@@ -1,19 +1,69 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// How deleted Splitwise expenses are removed from Lunch Money. The v1 API has
+// no documented single-transaction delete, so zeroing is the default.
+const (
+	DeleteModeZero   = "zero"   // set amount to 0 and add the deleted tag
+	DeleteModeDelete = "delete" // hard delete the transaction
+)
+
+// Where sync state is kept; see the state package.
+const (
+	StateStoreComments = "comments" // sync comments on the Splitwise expenses
+	StateStoreFile     = "file"     // local JSON file at StateFile
+)
+
+const (
+	// DefaultSyncInterval is how often daemon mode polls Splitwise.
+	DefaultSyncInterval = 15 * time.Minute
+
+	// DefaultSyncTimeout bounds one sync cycle, API calls included.
+	DefaultSyncTimeout = 30 * time.Minute
+
+	// DefaultCheckpointFile holds the time of the last successful sync.
+	DefaultCheckpointFile = "sync-checkpoint.json"
+
+	// DefaultCheckpointOverlap is how far before the checkpoint each
+	// incremental fetch starts.
+	DefaultCheckpointOverlap = time.Hour
+
+	// DefaultSplitwiseRateLimit matches splitwise.DefaultRateLimit.
+	DefaultSplitwiseRateLimit = 2.0
+
+	// DefaultCommentWorkers matches splitwise.DefaultCommentWorkers.
+	DefaultCommentWorkers = 4
+
+	// DefaultStateFile is where the "file" state store keeps sync state.
+	DefaultStateFile = "sync_state.json"
+)
+
 type Config struct {
 	SplitwiseBearerToken string
 	UserBSplitwiseID     int64
 	UserALunchMoney      LunchMoneyUserConfig
 	UserBLunchMoney      LunchMoneyUserConfig
 	TestMode             bool
+	DeleteMode           string
+	SyncInterval         time.Duration
+	SyncTimeout          time.Duration
+	CheckpointFile       string
+	CheckpointOverlap    time.Duration
+	SplitwiseRateLimit   float64 // requests per second
+	CommentWorkers       int     // concurrent comment fetches
+	StateStore           string  // "comments" or "file"
+	StateFile            string
+	Transactions         TransactionConfig
+	Comments             CommentConfig
 }
 
 type LunchMoneyUserConfig struct {
@@ -21,72 +71,185 @@ type LunchMoneyUserConfig struct {
 	SplitwiseAccountAssetID int64
 }
 
-func Load() (*Config, error) {
+// FieldError is a bad config value. Key is its name in the config file and
+// Env the environment variable that sets it, if there is one.
+type FieldError struct {
+	Key string
+	Env string
+	Err error
+}
+
+func (e *FieldError) Error() string {
+	if e.Env == "" {
+		return fmt.Sprintf("config %s: %v", e.Key, e.Err)
+	}
+	return fmt.Sprintf("config %s (%s): %v", e.Key, e.Env, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// Default returns the production config before any file or environment is
+// applied. Credentials and IDs are left empty.
+func Default() *Config {
+	cfg := baseConfig()
+	cfg.fillModeDefaults()
+	return cfg
+}
+
+// baseConfig holds the defaults that don't depend on TestMode.
+func baseConfig() *Config {
+	return &Config{
+		DeleteMode:         DeleteModeZero,
+		SyncInterval:       DefaultSyncInterval,
+		SyncTimeout:        DefaultSyncTimeout,
+		CheckpointFile:     DefaultCheckpointFile,
+		CheckpointOverlap:  DefaultCheckpointOverlap,
+		SplitwiseRateLimit: DefaultSplitwiseRateLimit,
+		CommentWorkers:     DefaultCommentWorkers,
+		StateStore:         StateStoreComments,
+		StateFile:          DefaultStateFile,
+	}
+}
+
+// Load builds the config from the defaults, then the config file at path (or
+// CONFIG_FILE when path is empty; no file if both are), then the environment
+// and .env. Later sources win. Markers and tags neither one sets get the
+// defaults for TestMode. Only malformed values are rejected here; callers
+// apply their flags and then call Validate.
+func Load(path string) (*Config, error) {
 
 	// shared state, load once, pass around
 
 	_ = godotenv.Load()
 
-	cfg := &Config{}
+	cfg := baseConfig()
 
-	cfg.SplitwiseBearerToken = os.Getenv("USER_A_SPLITWISE_BEARER_TOKEN")
-	if cfg.SplitwiseBearerToken == "" {
-		cfg.SplitwiseBearerToken = os.Getenv("USER_B_SPLITWISE_BEARER_TOKEN")
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
 	}
-	if cfg.SplitwiseBearerToken == "" {
-		return nil, fmt.Errorf("missing SPLITWISE_BEARER_TOKEN in environment")
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
 	}
 
-	var err error
-	cfg.UserBSplitwiseID, err = strconv.ParseInt(os.Getenv("USER_B_SPLITWISE_ID"), 10, 64)
-	if err != nil {
-		return nil, fmt.Errorf("invalid USER_B_SPLITWISE_ID: %w", err)
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
 	}
+	cfg.fillModeDefaults()
+	return cfg, nil
+}
 
-	userA, err := loadUserConfig("USER_A")
-	if err != nil {
-		return nil, fmt.Errorf("user A config: %w", err)
-	}
-	cfg.UserALunchMoney = userA
+func (cfg *Config) loadEnv() error {
+	// either user's Splitwise token works; A's wins if both are set
+	envString(&cfg.SplitwiseBearerToken, "USER_B_SPLITWISE_BEARER_TOKEN")
+	envString(&cfg.SplitwiseBearerToken, "USER_A_SPLITWISE_BEARER_TOKEN")
+	envString(&cfg.DeleteMode, "LM_DELETE_MODE")
+	envString(&cfg.CheckpointFile, "CHECKPOINT_FILE")
+	envString(&cfg.StateStore, "STATE_STORE")
+	envString(&cfg.StateFile, "STATE_FILE")
+	envString(&cfg.Comments.SyncMarker, "SYNC_COMMENT_MARKER")
+	envString(&cfg.Comments.DeletionMarker, "DELETION_COMMENT_MARKER")
+	envString(&cfg.Comments.LegacyTag, "LEGACY_TAG")
+
+	return errors.Join(
+		envInt64(&cfg.UserBSplitwiseID, "splitwise.friend_id", "USER_B_SPLITWISE_ID"),
+		loadUserConfig(&cfg.UserALunchMoney, "USER_A"),
+		loadUserConfig(&cfg.UserBLunchMoney, "USER_B"),
+		envBool(&cfg.TestMode, "sync.test_mode", "TEST"),
+		envDuration(&cfg.SyncInterval, "sync.interval", "SYNC_INTERVAL"),
+		envDuration(&cfg.SyncTimeout, "sync.timeout", "SYNC_TIMEOUT"),
+		envDuration(&cfg.CheckpointOverlap, "sync.checkpoint_overlap", "CHECKPOINT_OVERLAP"),
+		envFloat(&cfg.SplitwiseRateLimit, "splitwise.rate_limit", "SPLITWISE_RATE_LIMIT"),
+		envInt(&cfg.CommentWorkers, "splitwise.comment_workers", "COMMENT_WORKERS"),
+	)
+}
 
-	userB, err := loadUserConfig("USER_B")
-	if err != nil {
-		return nil, fmt.Errorf("user B config: %w", err)
-	}
-	cfg.UserBLunchMoney = userB
+func loadUserConfig(cfg *LunchMoneyUserConfig, user string) error {
+	envString(&cfg.BearerToken, user+"_LUNCHMONEY_BEARER_TOKEN")
+	return envInt64(&cfg.SplitwiseAccountAssetID, userKey(user)+".asset_id", user+"_LUNCHMONEY_SPLITWISE_ACCOUNT_ASSET_ID")
+}
 
-	testModeStr := os.Getenv("TEST")
-	if testModeStr != "" {
-		testMode, err := strconv.ParseBool(testModeStr)
-		if err != nil {
-			return nil, fmt.Errorf("invalid TEST value: %w", err)
-		}
-		cfg.TestMode = testMode
-	} else {
-		cfg.TestMode = false
+// userKey is the config file section for "USER_A" or "USER_B".
+func userKey(user string) string {
+	if user == "USER_A" {
+		return "lunchmoney.user_a"
 	}
+	return "lunchmoney.user_b"
+}
 
-	return cfg, nil
+// The env* helpers overwrite *dst when the variable is set and leave it alone
+// otherwise, so file values and defaults survive.
+
+func envString(dst *string, name string) {
+	if value := os.Getenv(name); value != "" {
+		*dst = value
+	}
 }
 
-func loadUserConfig(user string) (LunchMoneyUserConfig, error) {
-	var cfg LunchMoneyUserConfig
+func envBool(dst *bool, key, name string) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return &FieldError{Key: key, Env: name, Err: fmt.Errorf("invalid boolean %q", value)}
+	}
+	*dst = parsed
+	return nil
+}
 
-	cfg.BearerToken = os.Getenv(user + "_LUNCHMONEY_BEARER_TOKEN")
-	if cfg.BearerToken == "" {
-		return cfg, fmt.Errorf("missing %s_LUNCHMONEY_BEARER_TOKEN in environment", user)
+func envInt(dst *int, key, name string) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return &FieldError{Key: key, Env: name, Err: fmt.Errorf("invalid integer %q", value)}
 	}
+	*dst = parsed
+	return nil
+}
 
-	assetIDStr := os.Getenv(user + "_LUNCHMONEY_SPLITWISE_ACCOUNT_ASSET_ID")
-	if assetIDStr == "" {
-		return cfg, fmt.Errorf("missing %s_LUNCHMONEY_SPLITWISE_ACCOUNT_ASSET_ID in environment", user)
+func envInt64(dst *int64, key, name string) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
 	}
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return &FieldError{Key: key, Env: name, Err: fmt.Errorf("invalid integer %q", value)}
+	}
+	*dst = parsed
+	return nil
+}
 
-	assetID, err := strconv.ParseInt(assetIDStr, 10, 64)
+func envFloat(dst *float64, key, name string) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
 	if err != nil {
-		return cfg, fmt.Errorf("invalid %s_LUNCHMONEY_SPLITWISE_ACCOUNT_ASSET_ID: %w", user, err)
+		return &FieldError{Key: key, Env: name, Err: fmt.Errorf("invalid number %q", value)}
 	}
-	cfg.SplitwiseAccountAssetID = assetID
+	*dst = parsed
+	return nil
+}
 
-	return cfg, nil
+func envDuration(dst *time.Duration, key, name string) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return &FieldError{Key: key, Env: name, Err: fmt.Errorf("invalid duration %q", value)}
+	}
+	*dst = parsed
+	return nil
 }
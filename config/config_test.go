@@ -0,0 +1,278 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var envVars = []string{
+	"CONFIG_FILE",
+	"USER_A_SPLITWISE_BEARER_TOKEN", "USER_B_SPLITWISE_BEARER_TOKEN", "USER_B_SPLITWISE_ID",
+	"USER_A_LUNCHMONEY_BEARER_TOKEN", "USER_A_LUNCHMONEY_SPLITWISE_ACCOUNT_ASSET_ID",
+	"USER_B_LUNCHMONEY_BEARER_TOKEN", "USER_B_LUNCHMONEY_SPLITWISE_ACCOUNT_ASSET_ID",
+	"TEST", "LM_DELETE_MODE", "SYNC_INTERVAL", "SYNC_TIMEOUT", "CHECKPOINT_FILE", "CHECKPOINT_OVERLAP",
+	"SPLITWISE_RATE_LIMIT", "COMMENT_WORKERS", "STATE_STORE", "STATE_FILE",
+	"SYNC_COMMENT_MARKER", "DELETION_COMMENT_MARKER", "LEGACY_TAG",
+}
+
+// clearEnv unsets every variable Load reads; empty counts as unset.
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, name := range envVars {
+		t.Setenv(name, "")
+	}
+}
+
+func writeConfigFile(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	clearEnv(t)
+	path := writeConfigFile(t, `{
+		"splitwise": {"friend_id": 50086667},
+		"lunchmoney": {"user_a": {"asset_id": 111}},
+		"sync": {"interval": "5m", "test_mode": true},
+		"transactions": {"tags": {"sync": "from-file"}}
+	}`)
+	t.Setenv("SYNC_INTERVAL", "10m")
+	t.Setenv("USER_A_LUNCHMONEY_SPLITWISE_ACCOUNT_ASSET_ID", "333")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{name: "env beats file", got: cfg.SyncInterval, want: 10 * time.Minute},
+		{name: "env beats file, nested", got: cfg.UserALunchMoney.SplitwiseAccountAssetID, want: int64(333)},
+		{name: "file beats default", got: cfg.UserBSplitwiseID, want: int64(50086667)},
+		{name: "file switch", got: cfg.TestMode, want: true},
+		{name: "file tag", got: cfg.Transactions.Tags.Sync, want: "from-file"},
+		{name: "test mode default beside file tag", got: cfg.Transactions.Tags.Deleted, want: DefaultTransactionConfig(true).Tags.Deleted},
+		{name: "test mode external IDs beside file tags", got: cfg.Transactions.ExternalIDSuffix, want: "-test"},
+		{name: "default duration", got: cfg.SyncTimeout, want: DefaultSyncTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadModeDefaults(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want CommentConfig
+	}{
+		{
+			name: "production",
+			want: CommentConfig{SyncMarker: "Synced-to-LM", DeletionMarker: "Deleted-from-LM", LegacyTag: "pre-SW-LM-handshake"},
+		},
+		{
+			name: "test mode",
+			env:  map[string]string{"TEST": "true"},
+			want: CommentConfig{SyncMarker: "Synced-to-LM-test", DeletionMarker: "Deleted-from-LM-test", LegacyTag: "pre-SW-LM-handshake-test"},
+		},
+		{
+			name: "explicit marker in test mode",
+			env:  map[string]string{"TEST": "true", "SYNC_COMMENT_MARKER": "Staging-sync"},
+			want: CommentConfig{SyncMarker: "Staging-sync", DeletionMarker: "Deleted-from-LM-test", LegacyTag: "pre-SW-LM-handshake-test"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			cfg, err := Load("")
+			if err != nil {
+				t.Fatalf("Load() unexpected error: %v", err)
+			}
+			if cfg.Comments != tt.want {
+				t.Errorf("Comments = %+v, want %+v", cfg.Comments, tt.want)
+			}
+			if wantTags := DefaultTransactionConfig(cfg.TestMode).Tags; cfg.Transactions.Tags != wantTags {
+				t.Errorf("Tags = %+v, want %+v", cfg.Transactions.Tags, wantTags)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFileFromEnv(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("CONFIG_FILE", writeConfigFile(t, `{"sync": {"state_store": "file"}}`))
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.StateStore != StateStoreFile {
+		t.Errorf("StateStore = %q, want %q", cfg.StateStore, StateStoreFile)
+	}
+}
+
+func TestLoadErrorsNameTheKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		wantKey string
+	}{
+		{name: "unknown key", file: `{"sync": {"intervall": "5m"}}`, wantKey: "intervall"},
+		{name: "wrong type", file: `{"splitwise": {"friend_id": "wesley"}}`, wantKey: "splitwise.friend_id"},
+		{name: "bad duration", file: `{"sync": {"timeout": "soon"}}`, wantKey: "sync.timeout"},
+		{name: "bad env integer", file: `{}`, env: map[string]string{"COMMENT_WORKERS": "many"}, wantKey: "splitwise.comment_workers (COMMENT_WORKERS)"},
+		{name: "bad env boolean", file: `{}`, env: map[string]string{"TEST": "maybe"}, wantKey: "sync.test_mode (TEST)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			_, err := Load(writeConfigFile(t, tt.file))
+			if err == nil {
+				t.Fatal("Load() expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.wantKey) {
+				t.Errorf("Load() error = %q, want it to name %q", err, tt.wantKey)
+			}
+		})
+	}
+}
+
+func validConfig() *Config {
+	cfg := Default()
+	cfg.SplitwiseBearerToken = "sw-token"
+	cfg.UserBSplitwiseID = 50086667
+	cfg.UserALunchMoney = LunchMoneyUserConfig{BearerToken: "lm-token-a", SplitwiseAccountAssetID: 111}
+	cfg.UserBLunchMoney = LunchMoneyUserConfig{BearerToken: "lm-token-b", SplitwiseAccountAssetID: 222}
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		modify   func(*Config)
+		wantKeys []string
+	}{
+		{name: "valid", modify: func(*Config) {}},
+		{
+			name:     "missing credentials",
+			modify:   func(c *Config) { c.SplitwiseBearerToken = ""; c.UserBLunchMoney.BearerToken = "" },
+			wantKeys: []string{"splitwise.bearer_token (USER_A_SPLITWISE_BEARER_TOKEN)", "lunchmoney.user_b.bearer_token (USER_B_LUNCHMONEY_BEARER_TOKEN)"},
+		},
+		{
+			name:     "missing asset ID",
+			modify:   func(c *Config) { c.UserALunchMoney.SplitwiseAccountAssetID = 0 },
+			wantKeys: []string{"lunchmoney.user_a.asset_id"},
+		},
+		{
+			name:     "unknown delete mode",
+			modify:   func(c *Config) { c.DeleteMode = "archive" },
+			wantKeys: []string{"sync.delete_mode (LM_DELETE_MODE)"},
+		},
+		{
+			name:     "negative interval",
+			modify:   func(c *Config) { c.SyncInterval = -time.Minute },
+			wantKeys: []string{"sync.interval"},
+		},
+		{
+			name:     "unknown status",
+			modify:   func(c *Config) { c.Transactions.Status = "pending" },
+			wantKeys: []string{"transactions.status"},
+		},
+		{
+			name:     "empty tag",
+			modify:   func(c *Config) { c.Transactions.Tags.Payment = "" },
+			wantKeys: []string{"transactions.tags.payment"},
+		},
+		{
+			name:     "marker with a space",
+			modify:   func(c *Config) { c.Comments.SyncMarker = "Synced to LM" },
+			wantKeys: []string{"comments.sync_marker (SYNC_COMMENT_MARKER)"},
+		},
+		{
+			name:     "same markers",
+			modify:   func(c *Config) { c.Comments.DeletionMarker = c.Comments.SyncMarker },
+			wantKeys: []string{"comments.deletion_marker"},
+		},
+		{
+			name:     "template syntax",
+			modify:   func(c *Config) { c.Transactions.NotesTemplate = "{{.ExpenseID" },
+			wantKeys: []string{"transactions.notes_template"},
+		},
+		{
+			name:     "template field",
+			modify:   func(c *Config) { c.Transactions.NotesTemplate = "{{.Payee}}" },
+			wantKeys: []string{"transactions.notes_template"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.modify(cfg)
+
+			err := Validate(cfg)
+			if len(tt.wantKeys) == 0 {
+				if err != nil {
+					t.Errorf("Validate() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Validate() expected error, got nil")
+			}
+			for _, key := range tt.wantKeys {
+				if !strings.Contains(err.Error(), key) {
+					t.Errorf("Validate() error = %q, want it to name %q", err, key)
+				}
+			}
+		})
+	}
+}
+
+// The example file documents the schema, so it has to load and match the
+// defaults.
+func TestExampleConfig(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("USER_A_SPLITWISE_BEARER_TOKEN", "sw-token")
+	t.Setenv("USER_A_LUNCHMONEY_BEARER_TOKEN", "lm-token-a")
+	t.Setenv("USER_B_LUNCHMONEY_BEARER_TOKEN", "lm-token-b")
+
+	cfg, err := Load(filepath.Join("..", "config.example.json"))
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if err := Validate(cfg); err != nil {
+		t.Errorf("Validate() unexpected error: %v", err)
+	}
+	if cfg.Transactions != DefaultTransactionConfig(false) {
+		t.Errorf("example transactions = %+v, want the defaults %+v", cfg.Transactions, DefaultTransactionConfig(false))
+	}
+	if cfg.Comments != DefaultCommentConfig(false) {
+		t.Errorf("example comments = %+v, want the defaults %+v", cfg.Comments, DefaultCommentConfig(false))
+	}
+}
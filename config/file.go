@@ -0,0 +1,96 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// fileConfig is the config file schema; config.example.json documents every
+// key. Its fields point into a Config, so keys left out of the file keep the
+// value the Config already had. Durations are strings like "15m".
+type fileConfig struct {
+	Splitwise struct {
+		BearerToken    *string  `json:"bearer_token"`
+		FriendID       *int64   `json:"friend_id"`
+		RateLimit      *float64 `json:"rate_limit"`
+		CommentWorkers *int     `json:"comment_workers"`
+	} `json:"splitwise"`
+	LunchMoney struct {
+		UserA fileUser `json:"user_a"`
+		UserB fileUser `json:"user_b"`
+	} `json:"lunchmoney"`
+	Sync struct {
+		Interval          string  `json:"interval"`
+		Timeout           string  `json:"timeout"`
+		TestMode          *bool   `json:"test_mode"`
+		DeleteMode        *string `json:"delete_mode"`
+		CheckpointFile    *string `json:"checkpoint_file"`
+		CheckpointOverlap string  `json:"checkpoint_overlap"`
+		StateStore        *string `json:"state_store"`
+		StateFile         *string `json:"state_file"`
+	} `json:"sync"`
+	Transactions *TransactionConfig `json:"transactions"`
+	Comments     *CommentConfig     `json:"comments"`
+}
+
+type fileUser struct {
+	BearerToken *string `json:"bearer_token"`
+	AssetID     *int64  `json:"asset_id"`
+}
+
+func (cfg *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	var file fileConfig
+	file.Splitwise.BearerToken = &cfg.SplitwiseBearerToken
+	file.Splitwise.FriendID = &cfg.UserBSplitwiseID
+	file.Splitwise.RateLimit = &cfg.SplitwiseRateLimit
+	file.Splitwise.CommentWorkers = &cfg.CommentWorkers
+	file.LunchMoney.UserA = fileUser{BearerToken: &cfg.UserALunchMoney.BearerToken, AssetID: &cfg.UserALunchMoney.SplitwiseAccountAssetID}
+	file.LunchMoney.UserB = fileUser{BearerToken: &cfg.UserBLunchMoney.BearerToken, AssetID: &cfg.UserBLunchMoney.SplitwiseAccountAssetID}
+	file.Sync.TestMode = &cfg.TestMode
+	file.Sync.DeleteMode = &cfg.DeleteMode
+	file.Sync.CheckpointFile = &cfg.CheckpointFile
+	file.Sync.StateStore = &cfg.StateStore
+	file.Sync.StateFile = &cfg.StateFile
+	file.Transactions = &cfg.Transactions
+	file.Comments = &cfg.Comments
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			return fmt.Errorf("%s: %w", path, &FieldError{Key: typeErr.Field, Err: fmt.Errorf("cannot be a JSON %s", typeErr.Value)})
+		}
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	durations := []struct {
+		dst   *time.Duration
+		key   string
+		value string
+	}{
+		{&cfg.SyncInterval, "sync.interval", file.Sync.Interval},
+		{&cfg.SyncTimeout, "sync.timeout", file.Sync.Timeout},
+		{&cfg.CheckpointOverlap, "sync.checkpoint_overlap", file.Sync.CheckpointOverlap},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(d.value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, &FieldError{Key: d.key, Err: fmt.Errorf("invalid duration %q", d.value)})
+		}
+		*d.dst = parsed
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// MaskToken hides a token but keeps its last four characters, enough to tell
+// which token is configured without leaking it.
+func MaskToken(token string) string {
+	switch {
+	case token == "":
+		return ""
+	case len(token) < 12:
+		return "****"
+	default:
+		return "****" + token[len(token)-4:]
+	}
+}
+
+// Secrets returns every token in the config, for log redaction.
+func (c Config) Secrets() []string {
+	var secrets []string
+	for _, token := range []string{c.SplitwiseBearerToken, c.UserALunchMoney.BearerToken, c.UserBLunchMoney.BearerToken} {
+		if token != "" {
+			secrets = append(secrets, token)
+		}
+	}
+	return secrets
+}
+
+// LogValue logs the config with its tokens masked.
+func (c Config) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("splitwiseBearerToken", MaskToken(c.SplitwiseBearerToken)),
+		slog.Int64("userBSplitwiseID", c.UserBSplitwiseID),
+		slog.Any("userALunchMoney", c.UserALunchMoney),
+		slog.Any("userBLunchMoney", c.UserBLunchMoney),
+		slog.Bool("testMode", c.TestMode),
+		slog.String("deleteMode", c.DeleteMode),
+		slog.String("syncInterval", c.SyncInterval.String()),
+		slog.String("syncTimeout", c.SyncTimeout.String()),
+		slog.String("checkpointFile", c.CheckpointFile),
+		slog.String("checkpointOverlap", c.CheckpointOverlap.String()),
+		slog.Float64("splitwiseRateLimit", c.SplitwiseRateLimit),
+		slog.Int("commentWorkers", c.CommentWorkers),
+		slog.String("stateStore", c.StateStore),
+		slog.String("stateFile", c.StateFile),
+		slog.Any("transactions", c.Transactions),
+		slog.Any("comments", c.Comments),
+	)
+}
+
+// String prints the config with its tokens masked, so %v and %+v are safe.
+func (c Config) String() string {
+	return fmt.Sprintf("{SplitwiseBearerToken:%s UserBSplitwiseID:%d UserALunchMoney:%s UserBLunchMoney:%s TestMode:%t DeleteMode:%s SyncInterval:%s SyncTimeout:%s CheckpointFile:%s CheckpointOverlap:%s SplitwiseRateLimit:%g CommentWorkers:%d StateStore:%s StateFile:%s Transactions:%+v Comments:%+v}",
+		MaskToken(c.SplitwiseBearerToken), c.UserBSplitwiseID, c.UserALunchMoney, c.UserBLunchMoney,
+		c.TestMode, c.DeleteMode, c.SyncInterval, c.SyncTimeout, c.CheckpointFile, c.CheckpointOverlap,
+		c.SplitwiseRateLimit, c.CommentWorkers, c.StateStore, c.StateFile, c.Transactions, c.Comments)
+}
+
+// LogValue logs the user config with its token masked.
+func (c LunchMoneyUserConfig) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("bearerToken", MaskToken(c.BearerToken)),
+		slog.Int64("splitwiseAccountAssetID", c.SplitwiseAccountAssetID),
+	)
+}
+
+// String prints the user config with its token masked.
+func (c LunchMoneyUserConfig) String() string {
+	return fmt.Sprintf("{BearerToken:%s SplitwiseAccountAssetID:%d}", MaskToken(c.BearerToken), c.SplitwiseAccountAssetID)
+}
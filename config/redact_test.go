@@ -0,0 +1,61 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestConfigRedaction(t *testing.T) {
+	cfg := &Config{
+		SplitwiseBearerToken: "sw-secret-token-1234",
+		UserBSplitwiseID:     50086667,
+		UserALunchMoney:      LunchMoneyUserConfig{BearerToken: "lm-secret-token-aaaa", SplitwiseAccountAssetID: 111},
+		UserBLunchMoney:      LunchMoneyUserConfig{BearerToken: "lm-secret-token-bbbb", SplitwiseAccountAssetID: 222},
+	}
+
+	var logged bytes.Buffer
+	slog.New(slog.NewJSONHandler(&logged, nil)).Info("config", "config", cfg)
+
+	tests := []struct {
+		name   string
+		output string
+	}{
+		{name: "slog", output: logged.String()},
+		{name: "%v", output: fmt.Sprintf("%v", cfg)},
+		{name: "%+v", output: fmt.Sprintf("%+v", *cfg)},
+		{name: "user config", output: fmt.Sprint(cfg.UserALunchMoney)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, secret := range cfg.Secrets() {
+				if strings.Contains(tt.output, secret) {
+					t.Errorf("output contains token %q: %s", secret, tt.output)
+				}
+			}
+			if !strings.Contains(tt.output, "****aaaa") {
+				t.Errorf("output missing masked token ****aaaa: %s", tt.output)
+			}
+		})
+	}
+}
+
+func TestMaskToken(t *testing.T) {
+	tests := []struct {
+		token string
+		want  string
+	}{
+		{token: "", want: ""},
+		{token: "short", want: "****"},
+		{token: "a-much-longer-token-wxyz", want: "****wxyz"},
+	}
+
+	for _, tt := range tests {
+		if got := MaskToken(tt.token); got != tt.want {
+			t.Errorf("MaskToken(%q) = %q, want %q", tt.token, got, tt.want)
+		}
+	}
+}
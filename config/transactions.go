@@ -0,0 +1,96 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// Statuses a new Lunch Money transaction can be given.
+const (
+	StatusUncleared = "uncleared" // shows up for review
+	StatusCleared   = "cleared"
+)
+
+// DefaultNotesTemplate renders the notes the sync has always written.
+const DefaultNotesTemplate = `Expense ID: {{.ExpenseID}}
+{{if .Payment}}Splitwise payment{{else}}Original expense: {{.Description}}
+Amount owed{{if .OwedToYou}} to you{{end}}: ${{.Amount}}{{end}}{{with .Receipt}}
+[Receipt: {{.}}]{{end}}`
+
+// TransactionConfig shapes the Lunch Money transactions the sync writes.
+type TransactionConfig struct {
+	Status string `json:"status"`
+	// NotesTemplate is a text/template executed with NotesData.
+	NotesTemplate string    `json:"notes_template"`
+	Tags          TagConfig `json:"tags"`
+	// ExternalIDSuffix follows TestMode rather than the file, so a test run
+	// never claims the external IDs of production transactions.
+	ExternalIDSuffix string `json:"-"`
+}
+
+// TagConfig names the Lunch Money tags the sync adds.
+type TagConfig struct {
+	Sync          string `json:"sync"`          // every synced transaction
+	Reimbursement string `json:"reimbursement"` // money owed to the user
+	Payment       string `json:"payment"`       // settle-ups
+	Deleted       string `json:"deleted"`       // zeroed after a Splitwise delete
+}
+
+// NotesData is what NotesTemplate can use.
+type NotesData struct {
+	ExpenseID   int64
+	Description string
+	Amount      string // what is owed either way, always positive, e.g. "17.86"
+	Currency    string // lower case, e.g. "cad"
+	Payment     bool   // a settle-up rather than an expense
+	OwedToYou   bool
+	Receipt     string // link to the receipt image, if any
+}
+
+// DefaultTransactionConfig is what the sync wrote before it was configurable,
+// with the tags suffixed in test mode.
+func DefaultTransactionConfig(testMode bool) TransactionConfig {
+	cfg := TransactionConfig{
+		Status:        StatusUncleared,
+		NotesTemplate: DefaultNotesTemplate,
+		Tags: TagConfig{
+			Sync:          "Splitwise-lunchmoney-sync",
+			Reimbursement: "reimbursement-placeholder",
+			Payment:       "splitwise-payment",
+			Deleted:       "splitwise-deleted",
+		},
+	}
+	if testMode {
+		cfg.ExternalIDSuffix = testSuffix
+		cfg.Tags.Sync += testSuffix
+		cfg.Tags.Reimbursement += testSuffix
+		cfg.Tags.Payment += testSuffix
+		cfg.Tags.Deleted += testSuffix
+	}
+	return cfg
+}
+
+// ExternalID is the Lunch Money external_id of an expense's transaction,
+// e.g. "splitwise-4096669090", or "splitwise-payment-4096669090" for a
+// settle-up.
+func (c TransactionConfig) ExternalID(expenseID int64, payment bool) string {
+	if payment {
+		return fmt.Sprintf("splitwise-payment-%d%s", expenseID, c.ExternalIDSuffix)
+	}
+	return fmt.Sprintf("splitwise-%d%s", expenseID, c.ExternalIDSuffix)
+}
+
+// Notes renders NotesTemplate for one transaction.
+func (c TransactionConfig) Notes(data NotesData) (string, error) {
+	tmpl, err := template.New("notes").Parse(c.NotesTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	var notes strings.Builder
+	if err := tmpl.Execute(&notes, data); err != nil {
+		return "", err
+	}
+	return notes.String(), nil
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Validate checks a loaded config once flags have been applied, and must pass
+// before any API call. Every problem is reported, each naming its config file
+// key and environment variable.
+func Validate(cfg *Config) error {
+	var errs []error
+	check := func(ok bool, key, env, problem string) {
+		if !ok {
+			errs = append(errs, &FieldError{Key: key, Env: env, Err: errors.New(problem)})
+		}
+	}
+
+	check(cfg.SplitwiseBearerToken != "", "splitwise.bearer_token", "USER_A_SPLITWISE_BEARER_TOKEN", "missing")
+	check(cfg.UserBSplitwiseID > 0, "splitwise.friend_id", "USER_B_SPLITWISE_ID", "missing")
+	check(cfg.SplitwiseRateLimit > 0, "splitwise.rate_limit", "SPLITWISE_RATE_LIMIT", "must be positive")
+	check(cfg.CommentWorkers > 0, "splitwise.comment_workers", "COMMENT_WORKERS", "must be positive")
+
+	users := []struct {
+		env string
+		lm  LunchMoneyUserConfig
+	}{
+		{"USER_A", cfg.UserALunchMoney},
+		{"USER_B", cfg.UserBLunchMoney},
+	}
+	for _, user := range users {
+		check(user.lm.BearerToken != "", userKey(user.env)+".bearer_token", user.env+"_LUNCHMONEY_BEARER_TOKEN", "missing")
+		check(user.lm.SplitwiseAccountAssetID > 0, userKey(user.env)+".asset_id", user.env+"_LUNCHMONEY_SPLITWISE_ACCOUNT_ASSET_ID", "missing")
+	}
+
+	check(cfg.DeleteMode == DeleteModeZero || cfg.DeleteMode == DeleteModeDelete,
+		"sync.delete_mode", "LM_DELETE_MODE", fmt.Sprintf("%q must be %q or %q", cfg.DeleteMode, DeleteModeZero, DeleteModeDelete))
+	check(cfg.SyncInterval > 0, "sync.interval", "SYNC_INTERVAL", "must be positive")
+	check(cfg.SyncTimeout > 0, "sync.timeout", "SYNC_TIMEOUT", "must be positive")
+	check(cfg.CheckpointFile != "", "sync.checkpoint_file", "CHECKPOINT_FILE", "missing")
+	check(cfg.CheckpointOverlap > 0, "sync.checkpoint_overlap", "CHECKPOINT_OVERLAP", "must be positive")
+	check(cfg.StateStore == StateStoreComments || cfg.StateStore == StateStoreFile,
+		"sync.state_store", "STATE_STORE", fmt.Sprintf("%q must be %q or %q", cfg.StateStore, StateStoreComments, StateStoreFile))
+	check(cfg.StateFile != "", "sync.state_file", "STATE_FILE", "missing")
+
+	transactions := cfg.Transactions
+	check(transactions.Status == StatusUncleared || transactions.Status == StatusCleared,
+		"transactions.status", "", fmt.Sprintf("%q must be %q or %q", transactions.Status, StatusUncleared, StatusCleared))
+	check(transactions.Tags.Sync != "", "transactions.tags.sync", "", "missing")
+	check(transactions.Tags.Reimbursement != "", "transactions.tags.reimbursement", "", "missing")
+	check(transactions.Tags.Payment != "", "transactions.tags.payment", "", "missing")
+	check(transactions.Tags.Deleted != "", "transactions.tags.deleted", "", "missing")
+
+	comments := cfg.Comments
+	// the envelope header is "<marker> v1", so a marker can't contain spaces
+	check(comments.SyncMarker != "" && !strings.ContainsAny(comments.SyncMarker, " \t\n"),
+		"comments.sync_marker", "SYNC_COMMENT_MARKER", "must be one word")
+	check(comments.DeletionMarker != "" && !strings.ContainsAny(comments.DeletionMarker, " \t\n"),
+		"comments.deletion_marker", "DELETION_COMMENT_MARKER", "must be one word")
+	check(comments.SyncMarker != comments.DeletionMarker,
+		"comments.deletion_marker", "DELETION_COMMENT_MARKER", "must differ from comments.sync_marker")
+	check(comments.LegacyTag != "", "comments.legacy_tag", "LEGACY_TAG", "missing")
+
+	// a template that only fails at sync time would fail every expense
+	sample := NotesData{ExpenseID: 1, Description: "Groceries", Amount: "17.86", Currency: "cad", Receipt: "https://example.com/receipt.jpg"}
+	if _, err := transactions.Notes(sample); err != nil {
+		errs = append(errs, &FieldError{Key: "transactions.notes_template", Err: err})
+	}
+
+	return errors.Join(errs...)
+}
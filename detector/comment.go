@@ -0,0 +1,151 @@
+package detector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jasmineyas/splitwise-lunchmoney/models"
+)
+
+// Sync comments look like:
+//
+//	Synced-to-LM v1
+//	{"splitwise_expense_id":4096668238,...}
+//
+// The first line identifies the comment and the envelope version, the rest is
+// the JSON encoded models.SyncMetadata. Deletion comments use the same
+// envelope with their own marker and a models.DeletionMetadata payload. The
+// markers below are the production defaults; see Options.
+const (
+	SyncCommentMarker     = "Synced-to-LM"
+	DeletionCommentMarker = "Deleted-from-LM"
+	SyncCommentVersion    = 1
+)
+
+// ErrNotSyncComment is returned by the parse functions when the content
+// doesn't start with the expected marker at all.
+var ErrNotSyncComment = errors.New("not a sync comment")
+
+// SyncCommentError reports a comment that carries a marker but can't be
+// decoded. The expense it belongs to is neither synced nor safe to create.
+type SyncCommentError struct {
+	CommentID int64
+	Reason    string
+	Err       error
+}
+
+func (e *SyncCommentError) Error() string {
+	msg := "invalid sync comment"
+	if e.CommentID != 0 {
+		msg += fmt.Sprintf(" %d", e.CommentID)
+	}
+	msg += ": " + e.Reason
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *SyncCommentError) Unwrap() error {
+	return e.Err
+}
+
+// EncodeSyncComment renders metadata as a comment in the current version,
+// with the default marker.
+func EncodeSyncComment(metadata models.SyncMetadata) (string, error) {
+	return Options{}.EncodeSyncComment(metadata)
+}
+
+// ParseSyncComment decodes a comment written by EncodeSyncComment.
+func ParseSyncComment(content string) (models.SyncMetadata, error) {
+	return Options{}.ParseSyncComment(content)
+}
+
+// EncodeDeletionComment renders the comment posted once an expense's Lunch
+// Money transactions have been removed, with the default marker.
+func EncodeDeletionComment(metadata models.DeletionMetadata) (string, error) {
+	return Options{}.EncodeDeletionComment(metadata)
+}
+
+// ParseDeletionComment decodes a comment written by EncodeDeletionComment.
+func ParseDeletionComment(content string) (models.DeletionMetadata, error) {
+	return Options{}.ParseDeletionComment(content)
+}
+
+// EncodeSyncComment renders metadata as a comment with o's sync marker.
+func (o Options) EncodeSyncComment(metadata models.SyncMetadata) (string, error) {
+	if metadata.SplitwiseExpenseID <= 0 {
+		return "", fmt.Errorf("invalid expense ID: %d", metadata.SplitwiseExpenseID)
+	}
+	return encodeEnvelope(o.syncMarker(), metadata)
+}
+
+// ParseSyncComment decodes a comment carrying o's sync marker. Comments from
+// newer versions are decoded best-effort: unknown JSON fields are ignored so
+// an older binary can still tell that an expense was synced.
+func (o Options) ParseSyncComment(content string) (models.SyncMetadata, error) {
+	var metadata models.SyncMetadata
+	if err := parseEnvelope(content, o.syncMarker(), &metadata); err != nil {
+		return models.SyncMetadata{}, err
+	}
+
+	if metadata.SplitwiseExpenseID <= 0 {
+		return models.SyncMetadata{}, &SyncCommentError{Reason: "missing splitwise_expense_id"}
+	}
+
+	return metadata, nil
+}
+
+// EncodeDeletionComment renders a deletion comment with o's deletion marker.
+func (o Options) EncodeDeletionComment(metadata models.DeletionMetadata) (string, error) {
+	if metadata.SplitwiseExpenseID <= 0 {
+		return "", fmt.Errorf("invalid expense ID: %d", metadata.SplitwiseExpenseID)
+	}
+	return encodeEnvelope(o.deletionMarker(), metadata)
+}
+
+// ParseDeletionComment decodes a comment carrying o's deletion marker.
+func (o Options) ParseDeletionComment(content string) (models.DeletionMetadata, error) {
+	var metadata models.DeletionMetadata
+	if err := parseEnvelope(content, o.deletionMarker(), &metadata); err != nil {
+		return models.DeletionMetadata{}, err
+	}
+
+	if metadata.SplitwiseExpenseID <= 0 {
+		return models.DeletionMetadata{}, &SyncCommentError{Reason: "missing splitwise_expense_id"}
+	}
+
+	return metadata, nil
+}
+
+func encodeEnvelope(marker string, payload any) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("marshaling comment payload failed: %w", err)
+	}
+
+	return fmt.Sprintf("%s v%d\n%s", marker, SyncCommentVersion, data), nil
+}
+
+func parseEnvelope(content, marker string, payload any) error {
+	header, data, _ := strings.Cut(strings.TrimSpace(content), "\n")
+
+	gotMarker, versionStr, _ := strings.Cut(strings.TrimSpace(header), " ")
+	if gotMarker != marker {
+		return ErrNotSyncComment
+	}
+
+	version, err := strconv.Atoi(strings.TrimPrefix(versionStr, "v"))
+	if err != nil || !strings.HasPrefix(versionStr, "v") || version < 1 {
+		return &SyncCommentError{Reason: fmt.Sprintf("invalid version %q", versionStr), Err: err}
+	}
+
+	if err := json.Unmarshal([]byte(data), payload); err != nil {
+		return &SyncCommentError{Reason: fmt.Sprintf("decoding v%d payload", version), Err: err}
+	}
+
+	return nil
+}
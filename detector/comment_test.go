@@ -0,0 +1,164 @@
+package detector
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jasmineyas/splitwise-lunchmoney/models"
+)
+
+func TestEncodeParseSyncCommentRoundTrip(t *testing.T) {
+	metadata := models.SyncMetadata{
+		SplitwiseExpenseID: 4096668238,
+		SnapshotHash:       "abc123",
+		SyncedAt:           time.Date(2025, 12, 11, 0, 38, 40, 0, time.UTC),
+		SyncedBy:           9792490,
+		UserA: models.UserSyncData{
+			SplitwiseUserID: 9792490,
+			LMTransactionID: 12345,
+			LMAssetID:       234273,
+			LMRequestBody:   `{"date":"2025-12-11","amount":"-17.86"}`,
+			LMResponseBody:  `{"ids":["12345"]}`,
+		},
+		UserB: models.UserSyncData{SplitwiseUserID: 50086667, LMAssetID: 165646},
+	}
+
+	content, err := EncodeSyncComment(metadata)
+	if err != nil {
+		t.Fatalf("EncodeSyncComment() error = %v", err)
+	}
+	if !strings.HasPrefix(content, "Synced-to-LM v1\n") {
+		t.Errorf("EncodeSyncComment() = %q, want Synced-to-LM v1 header", content)
+	}
+
+	got, err := ParseSyncComment(content)
+	if err != nil {
+		t.Fatalf("ParseSyncComment() error = %v", err)
+	}
+	if got != metadata {
+		t.Errorf("ParseSyncComment() = %+v, want %+v", got, metadata)
+	}
+}
+
+func TestEncodeSyncCommentInvalidExpenseID(t *testing.T) {
+	if _, err := EncodeSyncComment(models.SyncMetadata{}); err == nil {
+		t.Error("expected error for missing expense ID, got nil")
+	}
+}
+
+func TestParseSyncComment(t *testing.T) {
+	tests := []struct {
+		name          string
+		content       string
+		wantExpenseID int64
+		wantNotSync   bool
+		wantErr       bool
+	}{
+		{
+			name:          "current version",
+			content:       "Synced-to-LM v1\n{\"splitwise_expense_id\":1}",
+			wantExpenseID: 1,
+		},
+		{
+			name:          "newer version with unknown fields is read best-effort",
+			content:       "Synced-to-LM v2\n{\"splitwise_expense_id\":1,\"new_field\":{\"x\":1}}",
+			wantExpenseID: 1,
+		},
+		{
+			name:          "surrounding whitespace",
+			content:       "  Synced-to-LM v1\n{\"splitwise_expense_id\":1}\n",
+			wantExpenseID: 1,
+		},
+		{
+			name:        "plain comment",
+			content:     "thanks for dinner!",
+			wantNotSync: true,
+		},
+		{
+			name:        "marker not at start",
+			content:     "see Synced-to-LM v1",
+			wantNotSync: true,
+		},
+		{
+			name:    "missing version",
+			content: "Synced-to-LM\n{\"splitwise_expense_id\":1}",
+			wantErr: true,
+		},
+		{
+			name:    "bad version",
+			content: "Synced-to-LM vX\n{\"splitwise_expense_id\":1}",
+			wantErr: true,
+		},
+		{
+			name:    "invalid json",
+			content: "Synced-to-LM v1\n{",
+			wantErr: true,
+		},
+		{
+			name:    "missing expense ID",
+			content: "Synced-to-LM v1\n{}",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSyncComment(tt.content)
+
+			if tt.wantNotSync {
+				if !errors.Is(err, ErrNotSyncComment) {
+					t.Errorf("ParseSyncComment() error = %v, want ErrNotSyncComment", err)
+				}
+				return
+			}
+
+			if tt.wantErr {
+				var commentErr *SyncCommentError
+				if !errors.As(err, &commentErr) {
+					t.Errorf("ParseSyncComment() error = %v, want *SyncCommentError", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ParseSyncComment() unexpected error: %v", err)
+			}
+			if got.SplitwiseExpenseID != tt.wantExpenseID {
+				t.Errorf("ParseSyncComment() expense ID = %d, want %d", got.SplitwiseExpenseID, tt.wantExpenseID)
+			}
+		})
+	}
+}
+
+func TestEncodeParseDeletionComment(t *testing.T) {
+	metadata := models.DeletionMetadata{
+		SplitwiseExpenseID: 4096668238,
+		DeletedFromLMAt:    time.Date(2025, 12, 12, 0, 0, 0, 0, time.UTC),
+		DeletedBy:          9792490,
+		Mode:               "zero",
+		UserA:              models.UserSyncData{SplitwiseUserID: 9792490, LMTransactionID: 12345},
+	}
+
+	content, err := EncodeDeletionComment(metadata)
+	if err != nil {
+		t.Fatalf("EncodeDeletionComment() error = %v", err)
+	}
+	if !strings.HasPrefix(content, "Deleted-from-LM v1\n") {
+		t.Errorf("EncodeDeletionComment() = %q, want Deleted-from-LM v1 header", content)
+	}
+
+	got, err := ParseDeletionComment(content)
+	if err != nil {
+		t.Fatalf("ParseDeletionComment() error = %v", err)
+	}
+	if got != metadata {
+		t.Errorf("ParseDeletionComment() = %+v, want %+v", got, metadata)
+	}
+
+	// the two envelopes must never be mistaken for each other
+	if _, err := ParseSyncComment(content); !errors.Is(err, ErrNotSyncComment) {
+		t.Errorf("ParseSyncComment(deletion comment) error = %v, want ErrNotSyncComment", err)
+	}
+}
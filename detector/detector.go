@@ -1,76 +1,269 @@
 package detector
 
 import (
-	"log"
-	"strings"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/jasmineyas/splitwise-lunchmoney/models"
 )
 
-// func DetectChanges(expenses []models.SplitwiseExpense, commentsMap map[int64][]models.SplitwiseComment) (toCreate []models.SplitwiseExpense, toUpdate []models.UpdateAction, toDelete []models.DeleteAction, err error) {
+// DetectChanges decides what to do with each expense. Only comments posted by
+// opts.SyncUserID (the Splitwise user the engine runs as) with opts' markers
+// are trusted. Expenses whose comments can't be parsed are left out of every
+// list and reported in the returned error.
+func DetectChanges(expenses []models.SplitwiseExpense, commentsMap map[int64][]models.SplitwiseComment, opts Options) (toCreate []models.SplitwiseExpense, toUpdate []models.UpdateAction, toDelete []models.DeleteAction, err error) {
+	return DetectChangesContext(context.Background(), expenses, commentsMap, opts)
+}
+
+// DetectChangesContext is DetectChanges but stops with ctx's error once ctx is
+// done, returning nothing.
+func DetectChangesContext(ctx context.Context, expenses []models.SplitwiseExpense, commentsMap map[int64][]models.SplitwiseComment, opts Options) (toCreate []models.SplitwiseExpense, toUpdate []models.UpdateAction, toDelete []models.DeleteAction, err error) {
+	var errs []error
+	readable := make([]models.SplitwiseExpense, 0, len(expenses))
+	states := make(map[int64]models.ExpenseState, len(expenses))
 
-func DetectChanges(expenses []models.SplitwiseExpense, commentsMap map[int64][]models.SplitwiseComment) (toCreate []models.SplitwiseExpense, err error) {
 	for _, expense := range expenses {
-		comments := commentsMap[expense.ID]
+		state, err := StateFromComments(commentsMap[expense.ID], opts)
+		if err != nil {
+			errs = append(errs, &ExpenseError{ExpenseID: expense.ID, Err: err})
+			continue
+		}
+		readable = append(readable, expense)
+		states[expense.ID] = state
+	}
+
+	toCreate, toUpdate, toDelete, err = DetectFromState(ctx, readable, states)
+	if ctx.Err() != nil {
+		return nil, nil, nil, err
+	}
+	return toCreate, toUpdate, toDelete, errors.Join(append(errs, err)...)
+}
+
+// StateFromComments reads an expense's sync state out of its comments. Only
+// comments posted by opts.SyncUserID are trusted and the latest of each kind
+// wins.
+func StateFromComments(comments []models.SplitwiseComment, opts Options) (models.ExpenseState, error) {
+	if hasLegacyTag(comments, opts) {
+		return models.ExpenseState{Legacy: true}, nil
+	}
+
+	var state models.ExpenseState
+	var err error
+
+	state.Sync, state.SyncedAt, err = findSyncComment(comments, opts)
+	if err != nil {
+		return models.ExpenseState{}, err
+	}
+	state.Deletion, state.DeletedAt, err = findDeletionComment(comments, opts)
+	if err != nil {
+		return models.ExpenseState{}, err
+	}
+	return state, nil
+}
+
+// ExpenseError is why DetectFromState left an expense out.
+type ExpenseError struct {
+	ExpenseID int64
+	Err       error
+}
 
-		// Check for legacy tag
-		if hasLegacyTag(comments) {
+func (e *ExpenseError) Error() string {
+	return fmt.Sprintf("expense %d: %v", e.ExpenseID, e.Err)
+}
+
+func (e *ExpenseError) Unwrap() error {
+	return e.Err
+}
+
+// SkippedExpenses lists the expenses err reports as left out, in the order
+// reported. ok is false if err holds anything that isn't an *ExpenseError.
+func SkippedExpenses(err error) (expenseIDs []int64, ok bool) {
+	errs := []error{err}
+	if joined, isJoined := err.(interface{ Unwrap() []error }); isJoined {
+		errs = joined.Unwrap()
+	}
+	for _, err := range errs {
+		expenseErr, isExpense := err.(*ExpenseError)
+		if !isExpense {
+			return nil, false
+		}
+		expenseIDs = append(expenseIDs, expenseErr.ExpenseID)
+	}
+	return expenseIDs, true
+}
+
+// DetectFromState decides what to do with each expense given what the sync
+// recorded for it. An expense missing from states was never synced, so
+// callers must leave out expenses whose state couldn't be loaded. Expenses
+// whose state doesn't fit them are left out of every list and reported in
+// the returned error, one *ExpenseError each.
+func DetectFromState(ctx context.Context, expenses []models.SplitwiseExpense, states map[int64]models.ExpenseState) (toCreate []models.SplitwiseExpense, toUpdate []models.UpdateAction, toDelete []models.DeleteAction, err error) {
+	var errs []error
+
+	for _, expense := range expenses {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, nil, err
+		}
+
+		state := states[expense.ID]
+		if state.Legacy {
 			continue
 		}
 
-		// Check for sync comment
-		// TODO - update to "Synced-to-LM" when in production
-		// okay this is a really bad practice in managing env and variables lol
-		syncComment := findSyncComment(comments, "test")
-
-		if syncComment == nil {
-			// No sync comment found, mark for creation
-			toCreate = append(toCreate, expense)
-		} else {
-			// skip these for now
-			log.Println("Found existing sync comment, skipping update/delete detection for now")
+		syncData := state.Sync
+		if syncData != nil && syncData.SplitwiseExpenseID != expense.ID {
+			errs = append(errs, &ExpenseError{ExpenseID: expense.ID, Err: &SyncCommentError{
+				Reason: fmt.Sprintf("comment belongs to expense %d", syncData.SplitwiseExpenseID),
+			}})
 			continue
-			// // Sync comment found, check for updates or deletions
-			// syncedData, parseErr := parseSyncComment(syncComment.Content)
-			// if parseErr != nil {
-			// 	return nil, nil, nil, parseErr
-			// }
-
-			// // Compare current expense with synced data to determine if update is needed
-			// if isExpenseUpdated(expense, syncedData) {
-			// 	changedFields := getChangedFields(expense, syncedData)
-			// 	updateAction := models.UpdateAction{
-			// 		ExpenseID:       expense.ID,
-			// 		Expense:         expense,
-			// 		ChangedFields:   changedFields,
-			// 		OldHash:         syncedData.SnapshotHash,
-			// 		NewHash:         computeExpenseHash(expense, comments),
-			// 		LunchMoneyTxnID: getLMTxnIDFromSW(comments) // Assuming UserA is the one who synced
-			// 	}
-			// 	toUpdate = append(toUpdate, updateAction)
-			// }
-
-			// // Additional logic can be added here to determine if deletion is needed
 		}
+
+		isDeleted := expense.DeletedAt != nil
+
+		switch {
+		case syncData == nil:
+			// No sync comment found, mark for creation unless it was deleted
+			// before it ever reached Lunch Money
+			if !isDeleted {
+				toCreate = append(toCreate, expense)
+			}
+
+		case state.Deletion != nil && !state.DeletedAt.Before(state.SyncedAt):
+			// Lunch Money side already removed; if the expense was restored
+			// in Splitwise since, sync it again
+			if !isDeleted {
+				toCreate = append(toCreate, expense)
+			}
+
+		case isDeleted:
+			toDelete = append(toDelete, models.DeleteAction{
+				ExpenseID:       expense.ID,
+				LunchMoneyTxnID: formatTxnID(syncData.UserA.LMTransactionID),
+				SyncData:        *syncData,
+			})
+
+		default:
+			// Compare the current expense with what was synced
+			updateAction, err := detectUpdate(expense, *syncData)
+			if err != nil {
+				errs = append(errs, &ExpenseError{ExpenseID: expense.ID, Err: err})
+				continue
+			}
+			if updateAction != nil {
+				toUpdate = append(toUpdate, *updateAction)
+			}
+		}
+	}
+
+	return toCreate, toUpdate, toDelete, errors.Join(errs...)
+}
+
+// detectUpdate returns an UpdateAction when the expense no longer hashes to
+// the snapshot stored in its sync comment.
+func detectUpdate(expense models.SplitwiseExpense, syncData models.SyncMetadata) (*models.UpdateAction, error) {
+	snapshot, err := NewExpenseSnapshot(expense)
+	if err != nil {
+		return nil, err
+	}
+
+	newHash := HashSnapshot(snapshot)
+	retry := syncData.UserA.Error != "" || syncData.UserB.Error != ""
+	if newHash == syncData.SnapshotHash && !retry {
+		return nil, nil
+	}
+
+	var changedFields []string
+	if syncData.Snapshot != nil {
+		changedFields = ChangedFields(*syncData.Snapshot, snapshot)
+	}
+	if retry {
+		// a user failed last time; the engine retries just that user
+		changedFields = append(changedFields, "retry")
 	}
 
-	return toCreate, nil
+	return &models.UpdateAction{
+		ExpenseID:       expense.ID,
+		Expense:         expense,
+		ChangedFields:   changedFields,
+		OldHash:         syncData.SnapshotHash,
+		NewHash:         newHash,
+		LunchMoneyTxnID: formatTxnID(syncData.UserA.LMTransactionID),
+		SyncData:        syncData,
+	}, nil
 }
 
-func hasLegacyTag(comments []models.SplitwiseComment) bool {
+// HasLegacyTag reports whether o.SyncUserID posted o's legacy tag as one of
+// the comments and hasn't deleted it.
+func (o Options) HasLegacyTag(comments []models.SplitwiseComment) bool {
+	return hasLegacyTag(comments, o)
+}
+
+// hasLegacyTag ignores tags posted by anyone but opts.SyncUserID, like
+// findSyncComment does for sync comments.
+func hasLegacyTag(comments []models.SplitwiseComment, opts Options) bool {
+	legacyTag := opts.legacyTag()
 	for _, comment := range comments {
-		if comment.Content == "pre-lunchmoney-sync" {
+		if comment.DeletedAt == nil && comment.User.ID == opts.SyncUserID && comment.Content == legacyTag {
 			return true
 		}
 	}
 	return false
 }
 
-func findSyncComment(comments []models.SplitwiseComment, tag string) *models.SplitwiseComment {
-	for _, comment := range comments {
-		if strings.Contains(comment.Content, tag) {
-			return &comment
+// formatTxnID renders a Lunch Money transaction ID for the action structs,
+// empty when the user has no transaction.
+func formatTxnID(id int64) string {
+	if id <= 0 {
+		return ""
+	}
+	return strconv.FormatInt(id, 10)
+}
+
+// findSyncComment returns the metadata from the most recent sync comment
+// posted by opts.SyncUserID and when it was posted, or nil if there is none.
+// Comments by anyone else are ignored even when they carry the marker.
+func findSyncComment(comments []models.SplitwiseComment, opts Options) (*models.SyncMetadata, time.Time, error) {
+	return findLatestComment(comments, opts.SyncUserID, opts.ParseSyncComment)
+}
+
+// findDeletionComment is findSyncComment for deletion comments.
+func findDeletionComment(comments []models.SplitwiseComment, opts Options) (*models.DeletionMetadata, time.Time, error) {
+	return findLatestComment(comments, opts.SyncUserID, opts.ParseDeletionComment)
+}
+
+func findLatestComment[T any](comments []models.SplitwiseComment, syncUserID int64, parse func(string) (T, error)) (*T, time.Time, error) {
+	var latest *models.SplitwiseComment
+	var latestData T
+
+	for i := range comments {
+		comment := &comments[i]
+		if comment.DeletedAt != nil || comment.User.ID != syncUserID {
+			continue
 		}
+
+		data, err := parse(comment.Content)
+		if errors.Is(err, ErrNotSyncComment) {
+			continue
+		}
+		if err != nil {
+			var commentErr *SyncCommentError
+			if errors.As(err, &commentErr) {
+				commentErr.CommentID = comment.ID
+			}
+			return nil, time.Time{}, err
+		}
+
+		if latest == nil || comment.CreatedAt.After(latest.CreatedAt) {
+			latest = comment
+			latestData = data
+		}
+	}
+
+	if latest == nil {
+		return nil, time.Time{}, nil
 	}
-	return nil
+	return &latestData, latest.CreatedAt, nil
 }
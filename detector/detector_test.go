@@ -1,12 +1,19 @@
 package detector
 
 import (
+	"context"
+	"errors"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/jasmineyas/splitwise-lunchmoney/models"
 )
 
 func TestHasLegacyTag(t *testing.T) {
+	const syncUserID = 9792490
+	deletedAt := time.Date(2025, 12, 11, 0, 0, 0, 0, time.UTC)
+
 	tests := []struct {
 		name     string
 		comments []models.SplitwiseComment
@@ -15,23 +22,37 @@ func TestHasLegacyTag(t *testing.T) {
 		{
 			name: "has exact legacy tag",
 			comments: []models.SplitwiseComment{
-				{ID: 1, Content: "pre-lunchmoney-sync"},
-				{ID: 2, Content: "some other comment"},
+				{ID: 1, Content: "pre-SW-LM-handshake", User: models.User{ID: syncUserID}},
+				{ID: 2, Content: "some other comment", User: models.User{ID: syncUserID}},
 			},
 			want: true,
 		},
 		{
 			name: "no legacy tag",
 			comments: []models.SplitwiseComment{
-				{ID: 1, Content: "synced-to-LM"},
-				{ID: 2, Content: "some comment"},
+				{ID: 1, Content: "synced-to-LM", User: models.User{ID: syncUserID}},
+				{ID: 2, Content: "some comment", User: models.User{ID: syncUserID}},
 			},
 			want: false,
 		},
 		{
 			name: "similar but not exact legacy tag",
 			comments: []models.SplitwiseComment{
-				{ID: 1, Content: "pre-lunchmoney-sync-v2"},
+				{ID: 1, Content: "pre-SW-LM-handshake-v2", User: models.User{ID: syncUserID}},
+			},
+			want: false,
+		},
+		{
+			name: "ignores legacy tag by another user",
+			comments: []models.SplitwiseComment{
+				{ID: 1, Content: "pre-SW-LM-handshake", User: models.User{ID: 50086667}},
+			},
+			want: false,
+		},
+		{
+			name: "ignores deleted legacy tag",
+			comments: []models.SplitwiseComment{
+				{ID: 1, Content: "pre-SW-LM-handshake", User: models.User{ID: syncUserID}, DeletedAt: &deletedAt},
 			},
 			want: false,
 		},
@@ -48,10 +69,10 @@ func TestHasLegacyTag(t *testing.T) {
 		{
 			name: "legacy tag among multiple comments",
 			comments: []models.SplitwiseComment{
-				{ID: 1, Content: "first comment"},
-				{ID: 2, Content: "second comment"},
-				{ID: 3, Content: "pre-lunchmoney-sync"},
-				{ID: 4, Content: "fourth comment"},
+				{ID: 1, Content: "first comment", User: models.User{ID: syncUserID}},
+				{ID: 2, Content: "second comment", User: models.User{ID: syncUserID}},
+				{ID: 3, Content: "pre-SW-LM-handshake", User: models.User{ID: syncUserID}},
+				{ID: 4, Content: "fourth comment", User: models.User{ID: syncUserID}},
 			},
 			want: true,
 		},
@@ -59,7 +80,7 @@ func TestHasLegacyTag(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := hasLegacyTag(tt.comments)
+			got := hasLegacyTag(tt.comments, Options{SyncUserID: syncUserID})
 			if got != tt.want {
 				t.Errorf("hasLegacyTag() = %v, want %v", got, tt.want)
 			}
@@ -68,136 +89,127 @@ func TestHasLegacyTag(t *testing.T) {
 }
 
 func TestFindSyncComment(t *testing.T) {
+	const syncUserID = 9792490
+	older := time.Date(2025, 12, 11, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+
 	tests := []struct {
-		name     string
-		comments []models.SplitwiseComment
-		tag      string
-		wantID   int64 // ID of the expected comment, 0 if nil expected
-		wantNil  bool
+		name          string
+		comments      []models.SplitwiseComment
+		wantExpenseID int64 // 0 if nil expected
+		wantHash      string
+		wantErr       bool
 	}{
 		{
-			name: "finds exact tag match",
+			name: "finds sync comment by sync user",
 			comments: []models.SplitwiseComment{
-				{ID: 1, Content: "test"},
-				{ID: 2, Content: "other"},
+				{ID: 1, Content: "random comment", User: models.User{ID: syncUserID}},
+				syncComment(t, 2, syncUserID, models.SyncMetadata{SplitwiseExpenseID: 42}),
 			},
-			tag:     "test",
-			wantID:  1,
-			wantNil: false,
+			wantExpenseID: 42,
 		},
 		{
-			name: "finds tag within content",
+			name: "ignores sync comment by another user",
 			comments: []models.SplitwiseComment{
-				{ID: 1, Content: "This is a test comment"},
-				{ID: 2, Content: "other"},
+				syncComment(t, 1, 50086667, models.SyncMetadata{SplitwiseExpenseID: 42}),
 			},
-			tag:     "test",
-			wantID:  1,
-			wantNil: false,
 		},
 		{
-			name: "finds synced-to-LM tag with metadata",
+			name: "ignores deleted sync comment",
 			comments: []models.SplitwiseComment{
-				{ID: 1, Content: "random comment"},
-				{ID: 2, Content: "synced-to-LM: tx_12345, hash: abc123"},
+				func() models.SplitwiseComment {
+					c := syncComment(t, 1, syncUserID, models.SyncMetadata{SplitwiseExpenseID: 42})
+					c.DeletedAt = &newer
+					return c
+				}(),
 			},
-			tag:     "synced-to-LM",
-			wantID:  2,
-			wantNil: false,
 		},
 		{
-			name: "returns first match when multiple exist",
+			name: "returns most recent when multiple exist",
 			comments: []models.SplitwiseComment{
-				{ID: 1, Content: "test first"},
-				{ID: 2, Content: "test second"},
-				{ID: 3, Content: "test third"},
+				withCreatedAt(syncComment(t, 2, syncUserID, models.SyncMetadata{SplitwiseExpenseID: 42, SnapshotHash: "new"}), newer),
+				withCreatedAt(syncComment(t, 1, syncUserID, models.SyncMetadata{SplitwiseExpenseID: 42, SnapshotHash: "old"}), older),
 			},
-			tag:     "test",
-			wantID:  1,
-			wantNil: false,
+			wantExpenseID: 42,
+			wantHash:      "new",
 		},
 		{
-			name: "tag not found",
+			name: "plain text mentioning the marker is not a sync comment",
 			comments: []models.SplitwiseComment{
-				{ID: 1, Content: "some comment"},
-				{ID: 2, Content: "another comment"},
+				{ID: 1, Content: "this is a test comment about Synced-to-LM", User: models.User{ID: syncUserID}},
 			},
-			tag:     "nonexistent",
-			wantNil: true,
 		},
 		{
-			name:     "empty comments list",
-			comments: []models.SplitwiseComment{},
-			tag:      "test",
-			wantNil:  true,
-		},
-		{
-			name:     "nil comments",
-			comments: nil,
-			tag:      "test",
-			wantNil:  true,
-		},
-		{
-			name: "empty tag matches all (contains behavior)",
+			name: "marker with broken payload is an error",
 			comments: []models.SplitwiseComment{
-				{ID: 1, Content: "any content"},
+				{ID: 1, Content: "Synced-to-LM v1\n{not json", User: models.User{ID: syncUserID}},
 			},
-			tag:     "",
-			wantID:  1, // Empty string is contained in any string
-			wantNil: false,
+			wantErr: true,
 		},
 		{
-			name: "case sensitive search",
-			comments: []models.SplitwiseComment{
-				{ID: 1, Content: "TEST uppercase"},
-				{ID: 2, Content: "test lowercase"},
-			},
-			tag:     "test",
-			wantID:  2, // Should find lowercase, not uppercase
-			wantNil: false,
-		},
-		{
-			name: "finds tag at beginning of content",
-			comments: []models.SplitwiseComment{
-				{ID: 1, Content: "test at start"},
-			},
-			tag:     "test",
-			wantID:  1,
-			wantNil: false,
+			name:     "empty comments list",
+			comments: []models.SplitwiseComment{},
 		},
 		{
-			name: "finds tag at end of content",
-			comments: []models.SplitwiseComment{
-				{ID: 1, Content: "content ends with test"},
-			},
-			tag:     "test",
-			wantID:  1,
-			wantNil: false,
+			name:     "nil comments",
+			comments: nil,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := findSyncComment(tt.comments, tt.tag)
+			got, _, err := findSyncComment(tt.comments, Options{SyncUserID: syncUserID})
 
-			if tt.wantNil {
-				if got != nil {
-					t.Errorf("findSyncComment() = %v (ID: %d), want nil", got.Content, got.ID)
-				}
-			} else {
-				if got == nil {
-					t.Error("findSyncComment() = nil, want non-nil")
-					return
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("findSyncComment() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				var commentErr *SyncCommentError
+				if !errors.As(err, &commentErr) {
+					t.Errorf("findSyncComment() error = %T, want *SyncCommentError", err)
 				}
-				if got.ID != tt.wantID {
-					t.Errorf("findSyncComment() returned comment ID %d with content %q, want ID %d", got.ID, got.Content, tt.wantID)
+				return
+			}
+
+			if tt.wantExpenseID == 0 {
+				if got != nil {
+					t.Errorf("findSyncComment() = %+v, want nil", got)
 				}
+				return
+			}
+
+			if got == nil {
+				t.Fatal("findSyncComment() = nil, want non-nil")
+			}
+			if got.SplitwiseExpenseID != tt.wantExpenseID {
+				t.Errorf("findSyncComment() expense ID = %d, want %d", got.SplitwiseExpenseID, tt.wantExpenseID)
+			}
+			if tt.wantHash != "" && got.SnapshotHash != tt.wantHash {
+				t.Errorf("findSyncComment() hash = %q, want %q", got.SnapshotHash, tt.wantHash)
 			}
 		})
 	}
 }
 
+// syncComment builds a comment the way the engine posts it.
+func syncComment(t *testing.T, id, userID int64, metadata models.SyncMetadata) models.SplitwiseComment {
+	t.Helper()
+
+	content, err := EncodeSyncComment(metadata)
+	if err != nil {
+		t.Fatalf("EncodeSyncComment() error = %v", err)
+	}
+	return models.SplitwiseComment{ID: id, Content: content, User: models.User{ID: userID}}
+}
+
+func withCreatedAt(comment models.SplitwiseComment, createdAt time.Time) models.SplitwiseComment {
+	comment.CreatedAt = createdAt
+	return comment
+}
+
 func TestDetectChanges(t *testing.T) {
+	const syncUserID = 9792490
+
 	tests := []struct {
 		name            string
 		expenses        []models.SplitwiseExpense
@@ -235,7 +247,7 @@ func TestDetectChanges(t *testing.T) {
 			},
 			commentsMap: map[int64][]models.SplitwiseComment{
 				1: {
-					{ID: 100, Content: "pre-lunchmoney-sync"},
+					{ID: 100, Content: "pre-SW-LM-handshake", User: models.User{ID: syncUserID}},
 				},
 			},
 			wantCreateCount: 0,
@@ -248,12 +260,67 @@ func TestDetectChanges(t *testing.T) {
 			},
 			commentsMap: map[int64][]models.SplitwiseComment{
 				1: {
-					{ID: 100, Content: "test comment synced"},
+					syncComment(t, 100, syncUserID, models.SyncMetadata{SplitwiseExpenseID: 1}),
 				},
 			},
 			wantCreateCount: 0,
 			wantCreateIDs:   []int64{},
 		},
+		{
+			name: "expense with sync comment from another user - should create",
+			expenses: []models.SplitwiseExpense{
+				{ID: 1, Description: "Someone else's comment"},
+			},
+			commentsMap: map[int64][]models.SplitwiseComment{
+				1: {
+					syncComment(t, 100, 50086667, models.SyncMetadata{SplitwiseExpenseID: 1}),
+				},
+			},
+			wantCreateCount: 1,
+			wantCreateIDs:   []int64{1},
+		},
+		{
+			name: "expense with comment mentioning test - should create",
+			expenses: []models.SplitwiseExpense{
+				{ID: 1, Description: "Chatty expense"},
+			},
+			commentsMap: map[int64][]models.SplitwiseComment{
+				1: {
+					{ID: 100, Content: "test comment", User: models.User{ID: syncUserID}},
+				},
+			},
+			wantCreateCount: 1,
+			wantCreateIDs:   []int64{1},
+		},
+		{
+			name: "expense with broken sync comment - skipped with error",
+			expenses: []models.SplitwiseExpense{
+				{ID: 1, Description: "Broken comment"},
+				{ID: 2, Description: "New expense"},
+			},
+			commentsMap: map[int64][]models.SplitwiseComment{
+				1: {
+					{ID: 100, Content: "Synced-to-LM v1\n{", User: models.User{ID: syncUserID}},
+				},
+			},
+			wantCreateCount: 1,
+			wantCreateIDs:   []int64{2},
+			wantErr:         true,
+		},
+		{
+			name: "sync comment for a different expense - skipped with error",
+			expenses: []models.SplitwiseExpense{
+				{ID: 1, Description: "Copied comment"},
+			},
+			commentsMap: map[int64][]models.SplitwiseComment{
+				1: {
+					syncComment(t, 100, syncUserID, models.SyncMetadata{SplitwiseExpenseID: 2}),
+				},
+			},
+			wantCreateCount: 0,
+			wantCreateIDs:   []int64{},
+			wantErr:         true,
+		},
 		{
 			name: "multiple expenses - all new",
 			expenses: []models.SplitwiseExpense{
@@ -281,13 +348,13 @@ func TestDetectChanges(t *testing.T) {
 			commentsMap: map[int64][]models.SplitwiseComment{
 				1: {},
 				2: {
-					{ID: 100, Content: "pre-lunchmoney-sync"},
+					{ID: 100, Content: "pre-SW-LM-handshake", User: models.User{ID: syncUserID}},
 				},
 				3: {
 					{ID: 101, Content: "random comment"},
 				},
 				4: {
-					{ID: 102, Content: "test sync metadata"},
+					syncComment(t, 102, syncUserID, models.SyncMetadata{SplitwiseExpenseID: 4}),
 				},
 				5: nil,
 			},
@@ -330,8 +397,8 @@ func TestDetectChanges(t *testing.T) {
 			},
 			commentsMap: map[int64][]models.SplitwiseComment{
 				1: {
-					{ID: 100, Content: "pre-lunchmoney-sync"},
-					{ID: 101, Content: "test sync"},
+					{ID: 100, Content: "pre-SW-LM-handshake", User: models.User{ID: syncUserID}},
+					syncComment(t, 101, syncUserID, models.SyncMetadata{SplitwiseExpenseID: 1}),
 				},
 			},
 			wantCreateCount: 0, // Should skip due to legacy tag check first
@@ -341,13 +408,19 @@ func TestDetectChanges(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotCreate, err := DetectChanges(tt.expenses, tt.commentsMap)
+			gotCreate, _, _, err := DetectChanges(tt.expenses, tt.commentsMap, Options{SyncUserID: syncUserID})
 
 			// Check error expectation
 			if (err != nil) != tt.wantErr {
 				t.Errorf("DetectChanges() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if err != nil {
+				var commentErr *SyncCommentError
+				if !errors.As(err, &commentErr) {
+					t.Errorf("DetectChanges() error = %T, want *SyncCommentError", err)
+				}
+			}
 
 			// Check create count
 			if len(gotCreate) != tt.wantCreateCount {
@@ -384,3 +457,350 @@ func TestDetectChanges(t *testing.T) {
 		})
 	}
 }
+
+func TestDetectChangesUpdates(t *testing.T) {
+	const syncUserID = 9792490
+
+	synced := baseExpense()
+	snapshot, err := NewExpenseSnapshot(synced)
+	if err != nil {
+		t.Fatal(err)
+	}
+	syncData := models.SyncMetadata{
+		SplitwiseExpenseID: synced.ID,
+		SnapshotHash:       HashSnapshot(snapshot),
+		Snapshot:           &snapshot,
+		UserA:              models.UserSyncData{SplitwiseUserID: syncUserID, LMTransactionID: 12345},
+	}
+
+	tests := []struct {
+		name        string
+		mutate      func(e *models.SplitwiseExpense)
+		syncData    models.SyncMetadata
+		wantUpdate  bool
+		wantChanged []string
+	}{
+		{
+			name:     "unchanged expense",
+			mutate:   func(e *models.SplitwiseExpense) {},
+			syncData: syncData,
+		},
+		{
+			name: "only formatting changed",
+			mutate: func(e *models.SplitwiseExpense) {
+				e.Cost = "35.720"
+			},
+			syncData: syncData,
+		},
+		{
+			name: "description typo fixed",
+			mutate: func(e *models.SplitwiseExpense) {
+				e.Description = "Save On Foods"
+			},
+			syncData:    syncData,
+			wantUpdate:  true,
+			wantChanged: []string{"description"},
+		},
+		{
+			name: "comment without snapshot still updates",
+			mutate: func(e *models.SplitwiseExpense) {
+				e.Description = "Save On Foods"
+			},
+			syncData: models.SyncMetadata{
+				SplitwiseExpenseID: synced.ID,
+				SnapshotHash:       "old-hash",
+				UserA:              models.UserSyncData{LMTransactionID: 12345},
+			},
+			wantUpdate: true,
+		},
+		{
+			name:   "unchanged expense with failed user is retried",
+			mutate: func(e *models.SplitwiseExpense) {},
+			syncData: models.SyncMetadata{
+				SplitwiseExpenseID: synced.ID,
+				SnapshotHash:       HashSnapshot(snapshot),
+				Snapshot:           &snapshot,
+				UserA:              models.UserSyncData{SplitwiseUserID: syncUserID, LMTransactionID: 12345},
+				UserB:              models.UserSyncData{SplitwiseUserID: 50086667, Error: "API error (status 500): oops"},
+			},
+			wantUpdate:  true,
+			wantChanged: []string{"retry"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expense := baseExpense()
+			tt.mutate(&expense)
+
+			commentsMap := map[int64][]models.SplitwiseComment{
+				expense.ID: {syncComment(t, 100, syncUserID, tt.syncData)},
+			}
+
+			toCreate, toUpdate, _, err := DetectChanges([]models.SplitwiseExpense{expense}, commentsMap, Options{SyncUserID: syncUserID})
+			if err != nil {
+				t.Fatalf("DetectChanges() error = %v", err)
+			}
+			if len(toCreate) != 0 {
+				t.Errorf("DetectChanges() created %d items, want 0", len(toCreate))
+			}
+
+			if !tt.wantUpdate {
+				if len(toUpdate) != 0 {
+					t.Errorf("DetectChanges() updated %d items, want 0", len(toUpdate))
+				}
+				return
+			}
+
+			if len(toUpdate) != 1 {
+				t.Fatalf("DetectChanges() updated %d items, want 1", len(toUpdate))
+			}
+			got := toUpdate[0]
+			if got.ExpenseID != expense.ID {
+				t.Errorf("UpdateAction.ExpenseID = %d, want %d", got.ExpenseID, expense.ID)
+			}
+			if got.OldHash != tt.syncData.SnapshotHash {
+				t.Errorf("UpdateAction.OldHash = %s, want %s", got.OldHash, tt.syncData.SnapshotHash)
+			}
+			if got.NewHash == got.OldHash && !slices.Contains(tt.wantChanged, "retry") {
+				t.Error("UpdateAction.NewHash equals OldHash")
+			}
+			if got.LunchMoneyTxnID != "12345" {
+				t.Errorf("UpdateAction.LunchMoneyTxnID = %s, want 12345", got.LunchMoneyTxnID)
+			}
+			if !slices.Equal(got.ChangedFields, tt.wantChanged) {
+				t.Errorf("UpdateAction.ChangedFields = %v, want %v", got.ChangedFields, tt.wantChanged)
+			}
+		})
+	}
+}
+
+func TestDetectChangesDeletions(t *testing.T) {
+	const syncUserID = 9792490
+	syncedAt := time.Date(2025, 12, 11, 0, 0, 0, 0, time.UTC)
+	deletedAt := syncedAt.Add(time.Hour)
+
+	syncData := models.SyncMetadata{
+		SplitwiseExpenseID: 1,
+		UserA:              models.UserSyncData{SplitwiseUserID: syncUserID, LMTransactionID: 12345},
+	}
+
+	deletionComment := func(id, userID int64, createdAt time.Time) models.SplitwiseComment {
+		content, err := EncodeDeletionComment(models.DeletionMetadata{SplitwiseExpenseID: 1, DeletedBy: userID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return models.SplitwiseComment{ID: id, Content: content, User: models.User{ID: userID}, CreatedAt: createdAt}
+	}
+
+	tests := []struct {
+		name           string
+		deleted        bool
+		comments       []models.SplitwiseComment
+		wantCreate     bool
+		wantDelete     bool
+		wantDeleteTxID string
+	}{
+		{
+			name:    "deleted before it was ever synced",
+			deleted: true,
+		},
+		{
+			name:    "deleted after sync",
+			deleted: true,
+			comments: []models.SplitwiseComment{
+				withCreatedAt(syncComment(t, 100, syncUserID, syncData), syncedAt),
+			},
+			wantDelete:     true,
+			wantDeleteTxID: "12345",
+		},
+		{
+			name:    "deletion already propagated",
+			deleted: true,
+			comments: []models.SplitwiseComment{
+				withCreatedAt(syncComment(t, 100, syncUserID, syncData), syncedAt),
+				deletionComment(101, syncUserID, deletedAt),
+			},
+		},
+		{
+			name:    "deletion comment by another user is ignored",
+			deleted: true,
+			comments: []models.SplitwiseComment{
+				withCreatedAt(syncComment(t, 100, syncUserID, syncData), syncedAt),
+				deletionComment(101, 50086667, deletedAt),
+			},
+			wantDelete:     true,
+			wantDeleteTxID: "12345",
+		},
+		{
+			name: "restored in Splitwise after deletion",
+			comments: []models.SplitwiseComment{
+				withCreatedAt(syncComment(t, 100, syncUserID, syncData), syncedAt),
+				deletionComment(101, syncUserID, deletedAt),
+			},
+			wantCreate: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expense := models.SplitwiseExpense{ID: 1, Description: "Deleted expense"}
+			if tt.deleted {
+				expense.DeletedAt = &deletedAt
+			}
+
+			commentsMap := map[int64][]models.SplitwiseComment{1: tt.comments}
+			toCreate, toUpdate, toDelete, err := DetectChanges([]models.SplitwiseExpense{expense}, commentsMap, Options{SyncUserID: syncUserID})
+			if err != nil {
+				t.Fatalf("DetectChanges() error = %v", err)
+			}
+
+			if (len(toCreate) == 1) != tt.wantCreate {
+				t.Errorf("DetectChanges() created %d items, wantCreate %v", len(toCreate), tt.wantCreate)
+			}
+			if len(toUpdate) != 0 {
+				t.Errorf("DetectChanges() updated %d items, want 0", len(toUpdate))
+			}
+			if (len(toDelete) == 1) != tt.wantDelete {
+				t.Fatalf("DetectChanges() deleted %d items, wantDelete %v", len(toDelete), tt.wantDelete)
+			}
+			if tt.wantDelete && toDelete[0].LunchMoneyTxnID != tt.wantDeleteTxID {
+				t.Errorf("DeleteAction.LunchMoneyTxnID = %s, want %s", toDelete[0].LunchMoneyTxnID, tt.wantDeleteTxID)
+			}
+		})
+	}
+}
+
+func TestDetectChangesContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	expenses := []models.SplitwiseExpense{{ID: 1, Description: "groceries"}}
+	toCreate, toUpdate, toDelete, err := DetectChangesContext(ctx, expenses, nil, Options{SyncUserID: 9792490})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("DetectChangesContext() error = %v, want %v", err, context.Canceled)
+	}
+	if len(toCreate)+len(toUpdate)+len(toDelete) != 0 {
+		t.Errorf("DetectChangesContext() returned changes after cancellation: %d/%d/%d", len(toCreate), len(toUpdate), len(toDelete))
+	}
+}
+
+func TestDetectFromState(t *testing.T) {
+	expense := models.SplitwiseExpense{
+		ID:          1,
+		Description: "groceries",
+		Cost:        "20.00",
+		Date:        time.Date(2025, 12, 10, 0, 0, 0, 0, time.UTC),
+		Currency:    "CAD",
+	}
+	hash, err := GenerateSnapshotHash(expense)
+	if err != nil {
+		t.Fatal(err)
+	}
+	syncedAt := time.Date(2025, 12, 11, 0, 0, 0, 0, time.UTC)
+	synced := &models.SyncMetadata{SplitwiseExpenseID: 1, SnapshotHash: hash, UserA: models.UserSyncData{LMTransactionID: 12345}}
+
+	deletedExpense := expense
+	deletedExpense.DeletedAt = &syncedAt
+
+	tests := []struct {
+		name       string
+		expense    models.SplitwiseExpense
+		states     map[int64]models.ExpenseState
+		wantCreate int
+		wantDelete int
+		wantErr    bool
+	}{
+		{name: "never synced", expense: expense, wantCreate: 1},
+		{name: "legacy", expense: expense, states: map[int64]models.ExpenseState{1: {Legacy: true}}},
+		{name: "synced and unchanged", expense: expense, states: map[int64]models.ExpenseState{1: {Sync: synced, SyncedAt: syncedAt}}},
+		{name: "deleted after sync", expense: deletedExpense, states: map[int64]models.ExpenseState{1: {Sync: synced, SyncedAt: syncedAt}}, wantDelete: 1},
+		{
+			name:    "state of another expense",
+			expense: expense,
+			states:  map[int64]models.ExpenseState{1: {Sync: &models.SyncMetadata{SplitwiseExpenseID: 2}, SyncedAt: syncedAt}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			toCreate, toUpdate, toDelete, err := DetectFromState(context.Background(), []models.SplitwiseExpense{tt.expense}, tt.states)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DetectFromState() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if skipped, ok := SkippedExpenses(err); tt.wantErr && (!ok || !slices.Equal(skipped, []int64{tt.expense.ID})) {
+				t.Errorf("SkippedExpenses() = %v, %v; want [%d], true", skipped, ok, tt.expense.ID)
+			}
+			if len(toCreate) != tt.wantCreate || len(toUpdate) != 0 || len(toDelete) != tt.wantDelete {
+				t.Errorf("DetectFromState() = %d create, %d update, %d delete; want %d, 0, %d",
+					len(toCreate), len(toUpdate), len(toDelete), tt.wantCreate, tt.wantDelete)
+			}
+		})
+	}
+}
+
+func TestStateFromCommentsOptionsIsolation(t *testing.T) {
+	const syncUserID = 9792490
+	user := models.User{ID: syncUserID}
+	production := Options{SyncUserID: syncUserID}
+	testRun := Options{SyncUserID: syncUserID, SyncMarker: "Synced-to-LM-test", DeletionMarker: "Deleted-from-LM-test", LegacyTag: "pre-SW-LM-handshake-test"}
+
+	productionSync, err := production.EncodeSyncComment(models.SyncMetadata{SplitwiseExpenseID: 1, SnapshotHash: "prod"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSync, err := testRun.EncodeSyncComment(models.SyncMetadata{SplitwiseExpenseID: 1, SnapshotHash: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testDeletion, err := testRun.EncodeDeletionComment(models.DeletionMetadata{SplitwiseExpenseID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		opts       Options
+		comments   []string
+		wantHash   string
+		wantDelete bool
+		wantLegacy bool
+	}{
+		{name: "production ignores test comments", opts: production, comments: []string{testSync, testDeletion}},
+		{name: "test ignores production comments", opts: testRun, comments: []string{productionSync}},
+		{name: "production reads its own", opts: production, comments: []string{productionSync, testSync, testDeletion}, wantHash: "prod"},
+		{name: "test reads its own", opts: testRun, comments: []string{productionSync, testSync, testDeletion}, wantHash: "test", wantDelete: true},
+		{name: "production ignores test legacy tag", opts: production, comments: []string{"pre-SW-LM-handshake-test"}},
+		{name: "test ignores production legacy tag", opts: testRun, comments: []string{"pre-SW-LM-handshake"}},
+		{name: "test legacy tag", opts: testRun, comments: []string{"pre-SW-LM-handshake-test"}, wantLegacy: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var comments []models.SplitwiseComment
+			for i, content := range tt.comments {
+				comments = append(comments, models.SplitwiseComment{ID: int64(i + 1), Content: content, User: user})
+			}
+
+			got, err := StateFromComments(comments, tt.opts)
+			if err != nil {
+				t.Fatalf("StateFromComments() error = %v", err)
+			}
+
+			var gotHash string
+			if got.Sync != nil {
+				gotHash = got.Sync.SnapshotHash
+			}
+			if gotHash != tt.wantHash {
+				t.Errorf("StateFromComments() sync hash = %q, want %q", gotHash, tt.wantHash)
+			}
+			if (got.Deletion != nil) != tt.wantDelete {
+				t.Errorf("StateFromComments() deletion = %+v, want present %v", got.Deletion, tt.wantDelete)
+			}
+			if got.Legacy != tt.wantLegacy {
+				t.Errorf("StateFromComments() legacy = %v, want %v", got.Legacy, tt.wantLegacy)
+			}
+		})
+	}
+}
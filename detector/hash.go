@@ -0,0 +1,123 @@
+package detector
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jasmineyas/splitwise-lunchmoney/models"
+)
+
+// NewExpenseSnapshot reduces an expense to the fields that affect Lunch Money,
+// normalized so that amount formatting ("17.8" vs "17.80") and the order of
+// users or repayments don't matter.
+func NewExpenseSnapshot(expense models.SplitwiseExpense) (models.ExpenseSnapshot, error) {
+	cost, err := normalizeAmount(expense.Cost)
+	if err != nil {
+		return models.ExpenseSnapshot{}, fmt.Errorf("expense %d cost: %w", expense.ID, err)
+	}
+
+	snapshot := models.ExpenseSnapshot{
+		Cost:        cost,
+		Date:        expense.Date.UTC().Format("2006-01-02"),
+		Currency:    strings.ToUpper(strings.TrimSpace(expense.Currency)),
+		Description: strings.TrimSpace(expense.Description),
+		Repayments:  make([]models.Repayment, 0, len(expense.Repayments)),
+		Shares:      make([]models.ShareSnapshot, 0, len(expense.Users)),
+	}
+
+	for i, repayment := range expense.Repayments {
+		amount, err := normalizeAmount(repayment.Amount)
+		if err != nil {
+			return models.ExpenseSnapshot{}, fmt.Errorf("expense %d repayment[%d]: %w", expense.ID, i, err)
+		}
+		snapshot.Repayments = append(snapshot.Repayments, models.Repayment{From: repayment.From, To: repayment.To, Amount: amount})
+	}
+
+	for i, user := range expense.Users {
+		paid, err := normalizeAmount(user.PaidShare)
+		if err != nil {
+			return models.ExpenseSnapshot{}, fmt.Errorf("expense %d users[%d] paid_share: %w", expense.ID, i, err)
+		}
+		owed, err := normalizeAmount(user.OwedShare)
+		if err != nil {
+			return models.ExpenseSnapshot{}, fmt.Errorf("expense %d users[%d] owed_share: %w", expense.ID, i, err)
+		}
+
+		userID := user.UserID
+		if userID == 0 {
+			userID = user.User.ID
+		}
+		snapshot.Shares = append(snapshot.Shares, models.ShareSnapshot{UserID: userID, PaidShare: paid, OwedShare: owed})
+	}
+
+	slices.SortFunc(snapshot.Repayments, func(a, b models.Repayment) int {
+		return cmp.Or(cmp.Compare(a.From, b.From), cmp.Compare(a.To, b.To), strings.Compare(a.Amount, b.Amount))
+	})
+	slices.SortFunc(snapshot.Shares, func(a, b models.ShareSnapshot) int {
+		return cmp.Compare(a.UserID, b.UserID)
+	})
+
+	return snapshot, nil
+}
+
+// HashSnapshot returns the hex SHA-256 of the snapshot's JSON encoding. The
+// struct has a fixed field order and sorted slices, so equal snapshots always
+// hash the same.
+func HashSnapshot(snapshot models.ExpenseSnapshot) string {
+	payload, _ := json.Marshal(snapshot)
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateSnapshotHash is the change-detection hash stored in sync comments.
+func GenerateSnapshotHash(expense models.SplitwiseExpense) (string, error) {
+	snapshot, err := NewExpenseSnapshot(expense)
+	if err != nil {
+		return "", err
+	}
+	return HashSnapshot(snapshot), nil
+}
+
+// ChangedFields lists which parts of the expense differ between two
+// snapshots, e.g. ["amount", "description"].
+func ChangedFields(old, current models.ExpenseSnapshot) []string {
+	var changed []string
+
+	if old.Cost != current.Cost {
+		changed = append(changed, "amount")
+	}
+	if old.Date != current.Date {
+		changed = append(changed, "date")
+	}
+	if old.Currency != current.Currency {
+		changed = append(changed, "currency")
+	}
+	if old.Description != current.Description {
+		changed = append(changed, "description")
+	}
+	if !slices.Equal(old.Repayments, current.Repayments) {
+		changed = append(changed, "repayments")
+	}
+	if !slices.Equal(old.Shares, current.Shares) {
+		changed = append(changed, "shares")
+	}
+
+	return changed
+}
+
+func normalizeAmount(amount string) (string, error) {
+	if strings.TrimSpace(amount) == "" {
+		return models.FormatCents(0), nil
+	}
+
+	cents, err := models.ParseCents(amount)
+	if err != nil {
+		return "", err
+	}
+	return models.FormatCents(cents), nil
+}
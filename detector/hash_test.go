@@ -0,0 +1,188 @@
+package detector
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jasmineyas/splitwise-lunchmoney/models"
+)
+
+func baseExpense() models.SplitwiseExpense {
+	return models.SplitwiseExpense{
+		ID:          4096668238,
+		Description: "save on foods",
+		Cost:        "35.72",
+		Date:        time.Date(2025, 10, 11, 6, 58, 32, 0, time.UTC),
+		Currency:    "CAD",
+		Repayments: []models.Repayment{
+			{From: 50086667, To: 9792490, Amount: "17.86"},
+			{From: 50043932, To: 9792490, Amount: "1.8"},
+		},
+		Users: []models.ExpenseUser{
+			{UserID: 9792490, PaidShare: "35.72", OwedShare: "16.06"},
+			{UserID: 50086667, PaidShare: "0.0", OwedShare: "17.86"},
+			{UserID: 50043932, PaidShare: "0.0", OwedShare: "1.80"},
+		},
+	}
+}
+
+func TestGenerateSnapshotHashStable(t *testing.T) {
+	want, err := GenerateSnapshotHash(baseExpense())
+	if err != nil {
+		t.Fatalf("GenerateSnapshotHash() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(e *models.SplitwiseExpense)
+	}{
+		{
+			name: "decimal formatting",
+			mutate: func(e *models.SplitwiseExpense) {
+				e.Cost = "35.720"
+				e.Repayments[1].Amount = "1.80"
+				e.Users[2].OwedShare = "1.8"
+			},
+		},
+		{
+			name: "user ordering",
+			mutate: func(e *models.SplitwiseExpense) {
+				slices.Reverse(e.Users)
+			},
+		},
+		{
+			name: "repayment ordering",
+			mutate: func(e *models.SplitwiseExpense) {
+				slices.Reverse(e.Repayments)
+			},
+		},
+		{
+			name: "time of day and currency case",
+			mutate: func(e *models.SplitwiseExpense) {
+				e.Date = time.Date(2025, 10, 11, 23, 0, 0, 0, time.UTC)
+				e.Currency = "cad"
+			},
+		},
+		{
+			name: "fields that don't reach Lunch Money",
+			mutate: func(e *models.SplitwiseExpense) {
+				e.Users[0].NetBalance = "19.66"
+				e.Users[0].User.FirstName = "Jasmine"
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expense := baseExpense()
+			tt.mutate(&expense)
+
+			got, err := GenerateSnapshotHash(expense)
+			if err != nil {
+				t.Fatalf("GenerateSnapshotHash() error = %v", err)
+			}
+			if got != want {
+				t.Errorf("GenerateSnapshotHash() = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestGenerateSnapshotHashJSONFieldOrder(t *testing.T) {
+	a := `{"id":1,"cost":"10.0","currency_code":"CAD","date":"2025-10-11T00:00:00Z","description":"x",
+		"repayments":[{"from":2,"to":1,"amount":"10.0"}],"users":[{"user_id":1,"paid_share":"10.0","owed_share":"0.0"}]}`
+	b := `{"users":[{"owed_share":"0.00","paid_share":"10","user_id":1}],"repayments":[{"amount":"10","to":1,"from":2}],
+		"description":"x","date":"2025-10-11T00:00:00Z","currency_code":"CAD","cost":"10.00","id":1}`
+
+	var expenseA, expenseB models.SplitwiseExpense
+	if err := json.Unmarshal([]byte(a), &expenseA); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(b), &expenseB); err != nil {
+		t.Fatal(err)
+	}
+
+	hashA, err := GenerateSnapshotHash(expenseA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashB, err := GenerateSnapshotHash(expenseB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hashA != hashB {
+		t.Errorf("hash differs across JSON field order: %s vs %s", hashA, hashB)
+	}
+}
+
+func TestGenerateSnapshotHashInvalidAmount(t *testing.T) {
+	expense := baseExpense()
+	expense.Repayments[0].Amount = "seventeen"
+
+	if _, err := GenerateSnapshotHash(expense); err == nil {
+		t.Error("expected error for invalid amount, got nil")
+	}
+}
+
+func TestChangedFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(e *models.SplitwiseExpense)
+		want   []string
+	}{
+		{
+			name:   "nothing changed",
+			mutate: func(e *models.SplitwiseExpense) {},
+			want:   nil,
+		},
+		{
+			name: "typo fixed",
+			mutate: func(e *models.SplitwiseExpense) {
+				e.Description = "save-on-foods"
+			},
+			want: []string{"description"},
+		},
+		{
+			name: "amount changed",
+			mutate: func(e *models.SplitwiseExpense) {
+				e.Cost = "40.00"
+				e.Repayments[0].Amount = "22.14"
+				e.Users[0].PaidShare = "40.00"
+				e.Users[1].OwedShare = "22.14"
+			},
+			want: []string{"amount", "repayments", "shares"},
+		},
+		{
+			name: "date and currency changed",
+			mutate: func(e *models.SplitwiseExpense) {
+				e.Date = e.Date.AddDate(0, 0, -3)
+				e.Currency = "USD"
+			},
+			want: []string{"date", "currency"},
+		},
+	}
+
+	old, err := NewExpenseSnapshot(baseExpense())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expense := baseExpense()
+			tt.mutate(&expense)
+
+			current, err := NewExpenseSnapshot(expense)
+			if err != nil {
+				t.Fatalf("NewExpenseSnapshot() error = %v", err)
+			}
+
+			got := ChangedFields(old, current)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ChangedFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
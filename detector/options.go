@@ -0,0 +1,49 @@
+package detector
+
+import "github.com/jasmineyas/splitwise-lunchmoney/config"
+
+// DefaultLegacyTag marks expenses from before the sync, which it must leave
+// alone. One-time-tag-legacy posts it as a comment of its own.
+const DefaultLegacyTag = "pre-SW-LM-handshake"
+
+// Options says which comments belong to this sync: the ones SyncUserID posted
+// with these markers. Test runs use markers of their own, so they can never
+// read or overwrite production state, nor production theirs. Empty markers
+// fall back to the production defaults.
+type Options struct {
+	SyncUserID     int64
+	SyncMarker     string
+	DeletionMarker string
+	LegacyTag      string
+}
+
+// NewOptions takes the markers from cfg.
+func NewOptions(cfg config.CommentConfig, syncUserID int64) Options {
+	return Options{
+		SyncUserID:     syncUserID,
+		SyncMarker:     cfg.SyncMarker,
+		DeletionMarker: cfg.DeletionMarker,
+		LegacyTag:      cfg.LegacyTag,
+	}
+}
+
+func (o Options) syncMarker() string {
+	if o.SyncMarker == "" {
+		return SyncCommentMarker
+	}
+	return o.SyncMarker
+}
+
+func (o Options) deletionMarker() string {
+	if o.DeletionMarker == "" {
+		return DeletionCommentMarker
+	}
+	return o.DeletionMarker
+}
+
+func (o Options) legacyTag() string {
+	if o.LegacyTag == "" {
+		return DefaultLegacyTag
+	}
+	return o.LegacyTag
+}
@@ -0,0 +1,211 @@
+// Retrying HTTP transport shared by the API clients
+
+package httpretry
+
+import (
+	"context"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultMaxRetries     = 3
+	DefaultBaseDelay      = time.Second
+	DefaultMaxDelay       = 20 * time.Second
+	DefaultAttemptTimeout = 60 * time.Second
+)
+
+// Transport retries requests that failed with a network error, a 429 or a
+// 5xx, waiting between attempts with capped exponential backoff and jitter.
+//
+// Only idempotent requests are retried: GET, HEAD, OPTIONS, PUT and DELETE,
+// plus anything whose context went through MarkIdempotent. A retried request
+// must have a replayable body; http.NewRequest sets GetBody for the usual
+// bytes and strings readers.
+//
+// AttemptTimeout bounds each attempt, including reading its response body,
+// so a hung request is retried instead of eating the whole budget. Use it in
+// place of http.Client.Timeout, which would also cover the backoff between
+// attempts. Zero means no per-attempt limit.
+type Transport struct {
+	Base           http.RoundTripper
+	MaxRetries     int
+	BaseDelay      time.Duration
+	MaxDelay       time.Duration
+	AttemptTimeout time.Duration
+
+	// sleep is swapped out in tests
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// New wraps base with the default retry policy. A nil base means
+// http.DefaultTransport.
+func New(base http.RoundTripper) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{
+		Base:           base,
+		MaxRetries:     DefaultMaxRetries,
+		BaseDelay:      DefaultBaseDelay,
+		MaxDelay:       DefaultMaxDelay,
+		AttemptTimeout: DefaultAttemptTimeout,
+		sleep:          Sleep,
+	}
+}
+
+type idempotentKey struct{}
+
+// MarkIdempotent flags a request as safe to send twice, e.g. a POST that
+// carries an external ID the server dedupes on.
+func MarkIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+// IsIdempotent reports whether req may be retried.
+func IsIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	marked, _ := req.Context().Value(idempotentKey{}).(bool)
+	return marked
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	canRetry := IsIdempotent(req) && (req.Body == nil || req.Body == http.NoBody || req.GetBody != nil)
+
+	for attempt := 0; ; attempt++ {
+		attemptReq := req
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attemptReq = req.Clone(req.Context())
+			attemptReq.Body = body
+		}
+
+		cancel := context.CancelFunc(func() {})
+		if t.AttemptTimeout > 0 {
+			var ctx context.Context
+			ctx, cancel = context.WithTimeout(req.Context(), t.AttemptTimeout)
+			attemptReq = attemptReq.WithContext(ctx)
+		}
+
+		resp, err := t.base().RoundTrip(attemptReq)
+		if !canRetry || attempt >= t.MaxRetries || !shouldRetry(req, resp, err) {
+			return releaseOnClose(resp, cancel), err
+		}
+
+		delay := t.backoff(attempt)
+		if resp != nil {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				if retryAfter > t.MaxDelay {
+					// the server wants us gone for longer than we're willing
+					// to block; let the caller see the 429
+					return releaseOnClose(resp, cancel), nil
+				}
+				delay = retryAfter
+			}
+			// drain so the connection can be reused
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		cancel()
+
+		sleep := t.sleep
+		if sleep == nil {
+			sleep = Sleep
+		}
+		if err := sleep(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// releaseOnClose ties the attempt's timeout to the response body, which the
+// caller reads after RoundTrip returns.
+func releaseOnClose(resp *http.Response, cancel context.CancelFunc) *http.Response {
+	if resp == nil {
+		cancel()
+		return nil
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base == nil {
+		return http.DefaultTransport
+	}
+	return t.Base
+}
+
+func shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		// a cancelled or expired request isn't a transient failure
+		return req.Context().Err() == nil
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// backoff doubles BaseDelay per attempt up to MaxDelay, then picks a random
+// delay in the upper half so concurrent clients spread out.
+func (t *Transport) backoff(attempt int) time.Duration {
+	delay := t.BaseDelay
+	for i := 0; i < attempt && delay < t.MaxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, t.MaxDelay)
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
+
+// parseRetryAfter reads either form of Retry-After: delay-seconds or an
+// HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// Sleep waits for d, or returns ctx's error once ctx is done.
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
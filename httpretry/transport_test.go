@@ -0,0 +1,283 @@
+package httpretry
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordingTransport is New with the sleeps captured instead of waited.
+func recordingTransport(delays *[]time.Duration) *Transport {
+	transport := New(nil)
+	transport.sleep = func(ctx context.Context, d time.Duration) error {
+		*delays = append(*delays, d)
+		return ctx.Err()
+	}
+	return transport
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		body           string
+		idempotent     bool
+		statuses       []int
+		retryAfter     []string
+		wantStatus     int
+		wantRequests   int
+		wantDelays     []time.Duration
+		wantBodyEachRq string
+	}{
+		{
+			name:         "429 then success",
+			method:       http.MethodGet,
+			statuses:     []int{429, 429, 200},
+			retryAfter:   []string{"2", "1", ""},
+			wantStatus:   200,
+			wantRequests: 3,
+			wantDelays:   []time.Duration{2 * time.Second, time.Second},
+		},
+		{
+			name:         "429 without Retry-After uses backoff",
+			method:       http.MethodGet,
+			statuses:     []int{429, 200},
+			wantStatus:   200,
+			wantRequests: 2,
+		},
+		{
+			name:         "retries exhausted returns last response",
+			method:       http.MethodGet,
+			statuses:     []int{429, 429, 429, 429, 429},
+			retryAfter:   []string{"0", "0", "0", "0", "0"},
+			wantStatus:   429,
+			wantRequests: DefaultMaxRetries + 1,
+			wantDelays:   []time.Duration{0, 0, 0},
+		},
+		{
+			name:         "502 is retried",
+			method:       http.MethodDelete,
+			statuses:     []int{502, 204},
+			wantStatus:   204,
+			wantRequests: 2,
+		},
+		{
+			name:         "Retry-After above max delay is not waited for",
+			method:       http.MethodGet,
+			statuses:     []int{429, 200},
+			retryAfter:   []string{"3600", ""},
+			wantStatus:   429,
+			wantRequests: 1,
+			wantDelays:   []time.Duration{},
+		},
+		{
+			name:         "4xx is not retried",
+			method:       http.MethodGet,
+			statuses:     []int{404, 200},
+			wantStatus:   404,
+			wantRequests: 1,
+			wantDelays:   []time.Duration{},
+		},
+		{
+			name:         "plain POST is not retried",
+			method:       http.MethodPost,
+			body:         `{"comment":"hi"}`,
+			statuses:     []int{429, 200},
+			wantStatus:   429,
+			wantRequests: 1,
+			wantDelays:   []time.Duration{},
+		},
+		{
+			name:           "marked POST is retried with its body",
+			method:         http.MethodPost,
+			body:           `{"external_id":"splitwise-1"}`,
+			idempotent:     true,
+			statuses:       []int{503, 200},
+			retryAfter:     []string{"0", ""},
+			wantStatus:     200,
+			wantRequests:   2,
+			wantDelays:     []time.Duration{0},
+			wantBodyEachRq: `{"external_id":"splitwise-1"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requestCount := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.wantBodyEachRq != "" {
+					body, _ := io.ReadAll(r.Body)
+					if string(body) != tt.wantBodyEachRq {
+						t.Errorf("request %d body = %q, want %q", requestCount, body, tt.wantBodyEachRq)
+					}
+				}
+				if requestCount < len(tt.retryAfter) && tt.retryAfter[requestCount] != "" {
+					w.Header().Set("Retry-After", tt.retryAfter[requestCount])
+				}
+				w.WriteHeader(tt.statuses[requestCount])
+				requestCount++
+			}))
+			defer server.Close()
+
+			var delays []time.Duration
+			client := &http.Client{Transport: recordingTransport(&delays)}
+
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+			req, err := http.NewRequest(tt.method, server.URL, body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.idempotent {
+				req = req.WithContext(MarkIdempotent(req.Context()))
+			}
+
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if requestCount != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", requestCount, tt.wantRequests)
+			}
+			if tt.wantDelays != nil {
+				if len(delays) != len(tt.wantDelays) {
+					t.Fatalf("delays = %v, want %v", delays, tt.wantDelays)
+				}
+				for i := range delays {
+					if delays[i] != tt.wantDelays[i] {
+						t.Errorf("delay[%d] = %v, want %v", i, delays[i], tt.wantDelays[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRoundTripNetworkError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := server.URL
+	server.Close()
+
+	var delays []time.Duration
+	client := &http.Client{Transport: recordingTransport(&delays)}
+
+	_, err := client.Get(url)
+	if err == nil {
+		t.Fatal("Get() expected error against a closed server")
+	}
+	if len(delays) != DefaultMaxRetries {
+		t.Errorf("retried %d times, want %d", len(delays), DefaultMaxRetries)
+	}
+}
+
+func TestRoundTripAttemptTimeout(t *testing.T) {
+	requestCount := 0
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+		if requestCount == 1 {
+			// hang until the test is done
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	var delays []time.Duration
+	transport := recordingTransport(&delays)
+	transport.AttemptTimeout = 50 * time.Millisecond
+
+	resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v, want the hung attempt retried", err)
+	}
+	defer resp.Body.Close()
+
+	// the body outlives RoundTrip, so its attempt must not be cancelled yet
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || string(body) != "ok" {
+		t.Errorf("body = %q, %v, want ok", body, err)
+	}
+	if requestCount != 2 {
+		t.Errorf("requests = %d, want 2", requestCount)
+	}
+}
+
+func TestRoundTripCancelledWhileWaiting(t *testing.T) {
+	requestCount := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	transport := New(nil)
+	transport.sleep = func(context.Context, time.Duration) error {
+		cancel()
+		return context.Canceled
+	}
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	_, err := (&http.Client{Transport: transport}).Do(req)
+	if err == nil {
+		t.Fatal("Do() expected error after cancel")
+	}
+	if requestCount != 1 {
+		t.Errorf("requests = %d, want 1", requestCount)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	transport := New(nil)
+
+	for attempt := 0; attempt < 100; attempt++ {
+		full := min(DefaultBaseDelay<<min(attempt, 10), DefaultMaxDelay)
+		got := transport.backoff(attempt)
+		if got < full/2 || got > full {
+			t.Errorf("backoff(%d) = %v, want between %v and %v", attempt, got, full/2, full)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 12, 1, 8, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{value: "", wantOK: false},
+		{value: "5", want: 5 * time.Second, wantOK: true},
+		{value: "-1", wantOK: false},
+		{value: "Mon, 01 Dec 2025 08:30:30 GMT", want: 30 * time.Second, wantOK: true},
+		{value: "Mon, 01 Dec 2025 08:00:00 GMT", want: 0, wantOK: true},
+		{value: "soon", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, ok := parseRetryAfter(tt.value, now)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("parseRetryAfter(%q) = %v, %v; want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+// slog handler that keeps secrets out of the logs
+
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// tokenPatterns catch credentials we weren't told about: Authorization
+// headers and token-looking JSON or query fields, e.g. echoed back in an API
+// error body.
+var tokenPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]+`),
+	regexp.MustCompile(`(?i)("(?:access_token|api_key|token|bearer_token|secret)"\s*:\s*")[^"]*`),
+	regexp.MustCompile(`(?i)((?:access_token|api_key|token)=)[^&\s]+`),
+}
+
+// RedactingHandler scrubs secrets from the message and every attribute
+// before passing records on: known secrets wherever they appear, plus
+// anything matching tokenPatterns. Errors and other values are scrubbed in
+// their string form.
+type RedactingHandler struct {
+	next    slog.Handler
+	secrets []string
+}
+
+// NewRedactingHandler wraps next. secrets are exact strings to hide, usually
+// config.Config.Secrets.
+func NewRedactingHandler(next slog.Handler, secrets ...string) *RedactingHandler {
+	var nonEmpty []string
+	for _, secret := range secrets {
+		if secret != "" {
+			nonEmpty = append(nonEmpty, secret)
+		}
+	}
+	return &RedactingHandler{next: next, secrets: nonEmpty}
+}
+
+// New returns a JSON logger writing to w that hides secrets.
+func New(w io.Writer, secrets ...string) *slog.Logger {
+	return slog.New(NewRedactingHandler(slog.NewJSONHandler(w, nil), secrets...))
+}
+
+func (h *RedactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *RedactingHandler) Handle(ctx context.Context, record slog.Record) error {
+	scrubbed := slog.NewRecord(record.Time, record.Level, h.scrub(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		scrubbed.AddAttrs(h.scrubAttr(attr))
+		return true
+	})
+	return h.next.Handle(ctx, scrubbed)
+}
+
+func (h *RedactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	scrubbed := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		scrubbed[i] = h.scrubAttr(attr)
+	}
+	return &RedactingHandler{next: h.next.WithAttrs(scrubbed), secrets: h.secrets}
+}
+
+func (h *RedactingHandler) WithGroup(name string) slog.Handler {
+	return &RedactingHandler{next: h.next.WithGroup(name), secrets: h.secrets}
+}
+
+func (h *RedactingHandler) scrubAttr(attr slog.Attr) slog.Attr {
+	value := attr.Value.Resolve()
+
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, h.scrub(value.String()))
+	case slog.KindGroup:
+		group := value.Group()
+		scrubbed := make([]slog.Attr, len(group))
+		for i, member := range group {
+			scrubbed[i] = h.scrubAttr(member)
+		}
+		return slog.Attr{Key: attr.Key, Value: slog.GroupValue(scrubbed...)}
+	case slog.KindAny:
+		if err, ok := value.Any().(error); ok {
+			return slog.String(attr.Key, h.scrub(err.Error()))
+		}
+		// anything else the JSON handler would print as-is; go through its
+		// text so nothing nested slips by
+		text := value.String()
+		if scrubbed := h.scrub(text); scrubbed != text {
+			return slog.String(attr.Key, scrubbed)
+		}
+		return slog.Attr{Key: attr.Key, Value: value}
+	default:
+		return slog.Attr{Key: attr.Key, Value: value}
+	}
+}
+
+func (h *RedactingHandler) scrub(s string) string {
+	for _, secret := range h.secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	for _, pattern := range tokenPatterns {
+		s = pattern.ReplaceAllString(s, "${1}"+redacted)
+	}
+	return s
+}
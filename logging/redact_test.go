@@ -0,0 +1,90 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/jasmineyas/splitwise-lunchmoney/apierror"
+)
+
+func TestRedactingHandler(t *testing.T) {
+	const secret = "lm-secret-token-aaaa"
+
+	tests := []struct {
+		name string
+		log  func(logger *slog.Logger)
+		leak string
+	}{
+		{
+			name: "known secret in message",
+			log:  func(logger *slog.Logger) { logger.Info("using token " + secret) },
+			leak: secret,
+		},
+		{
+			name: "known secret in attribute",
+			log:  func(logger *slog.Logger) { logger.Info("config", "token", secret) },
+			leak: secret,
+		},
+		{
+			name: "bearer header in error",
+			log: func(logger *slog.Logger) {
+				logger.Error("request failed", "error", errors.New("sent Authorization: Bearer abc.def-123"))
+			},
+			leak: "abc.def-123",
+		},
+		{
+			name: "token echoed in an API error body",
+			log: func(logger *slog.Logger) {
+				logger.Error("sync failed", "error", &apierror.Error{Service: apierror.Splitwise, StatusCode: 401, Body: `{"access_token": "echoed-back"}`})
+			},
+			leak: "echoed-back",
+		},
+		{
+			name: "secret inside a group",
+			log: func(logger *slog.Logger) {
+				logger.Info("config", slog.Group("user", slog.String("token", secret)))
+			},
+			leak: secret,
+		},
+		{
+			name: "secret in WithAttrs",
+			log:  func(logger *slog.Logger) { logger.With("token", secret).Info("hello") },
+			leak: secret,
+		},
+		{
+			name: "secret in a struct",
+			log: func(logger *slog.Logger) {
+				logger.Info("client", "client", struct{ Token string }{Token: secret})
+			},
+			leak: secret,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.log(New(&buf, secret))
+
+			if strings.Contains(buf.String(), tt.leak) {
+				t.Errorf("log leaked %q: %s", tt.leak, buf.String())
+			}
+			if !strings.Contains(buf.String(), redacted) {
+				t.Errorf("log missing %s marker: %s", redacted, buf.String())
+			}
+		})
+	}
+}
+
+func TestRedactingHandlerKeepsOtherAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	New(&buf, "secret-token").Info("Sync cycle finished", "created", 3, "duration", "1.2s")
+
+	for _, want := range []string{`"created":3`, `"duration":"1.2s"`, `"msg":"Sync cycle finished"`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("log missing %s: %s", want, buf.String())
+		}
+	}
+}
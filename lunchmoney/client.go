@@ -2,6 +2,7 @@ package lunchmoney
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,28 +10,73 @@ import (
 	"net/url"
 	"strconv"
 	"time"
+	"unicode/utf8"
 
+	"github.com/jasmineyas/splitwise-lunchmoney/apierror"
+	"github.com/jasmineyas/splitwise-lunchmoney/httpretry"
 	"github.com/jasmineyas/splitwise-lunchmoney/models"
+	"github.com/jasmineyas/splitwise-lunchmoney/ratelimit"
 )
 
+// MaxNotesLength is the longest note Lunch Money accepts, in characters.
+// Longer notes are rejected before anything is sent.
+const MaxNotesLength = 350
+
 type Client struct {
 	httpClient  *http.Client
 	baseURL     string
 	bearerToken string
+	limiter     *ratelimit.Limiter
 }
 
-func NewClient(bearerToken string) *Client {
-	return &Client{
-		httpClient:  &http.Client{Timeout: 60 * time.Second},
+// Option configures a Client.
+type Option func(*Client)
+
+// WithRateLimit limits requests per second. Lunch Money clients are
+// unlimited unless this or WithLimiter is given.
+func WithRateLimit(ratePerSecond float64, burst int) Option {
+	return func(c *Client) {
+		c.limiter = ratelimit.New(ratePerSecond, burst)
+	}
+}
+
+// WithLimiter shares a limiter between clients.
+func WithLimiter(limiter *ratelimit.Limiter) Option {
+	return func(c *Client) {
+		c.limiter = limiter
+	}
+}
+
+func NewClient(bearerToken string, opts ...Option) *Client {
+	c := &Client{
 		baseURL:     "https://dev.lunchmoney.app/v1",
 		bearerToken: bearerToken,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	var base http.RoundTripper
+	if c.limiter != nil {
+		base = &ratelimit.Transport{Limiter: c.limiter}
+	}
+	c.httpClient = &http.Client{Transport: httpretry.New(base)}
+	return c
+}
+
+// RateLimitStats reports how long requests have waited on the rate limiter,
+// zero when the client has none.
+func (c *Client) RateLimitStats() ratelimit.Stats {
+	if c.limiter == nil {
+		return ratelimit.Stats{}
+	}
+	return c.limiter.Stats()
 }
 
-func (c *Client) newRequest(method, endpoint string, body io.Reader) (*http.Request, error) {
+func (c *Client) newRequest(ctx context.Context, method, endpoint string, body io.Reader) (*http.Request, error) {
 	url := c.baseURL + endpoint
 
-	req, err := http.NewRequest(method, url, body)
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		return nil, err
 	}
@@ -42,11 +88,16 @@ func (c *Client) newRequest(method, endpoint string, body io.Reader) (*http.Requ
 }
 
 func (c *Client) VerifyAssetExist(assetID int64) (bool, error) {
+	return c.VerifyAssetExistContext(context.Background(), assetID)
+}
+
+// VerifyAssetExistContext is VerifyAssetExist with ctx attached to every request.
+func (c *Client) VerifyAssetExistContext(ctx context.Context, assetID int64) (bool, error) {
 	if assetID <= 0 {
 		return false, fmt.Errorf("invalid asset ID: %d", assetID)
 	}
 
-	req, err := c.newRequest("GET", "/assets", nil)
+	req, err := c.newRequest(ctx, "GET", "/assets", nil)
 	if err != nil {
 		return false, err
 	}
@@ -58,8 +109,7 @@ func (c *Client) VerifyAssetExist(assetID int64) (bool, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return false, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+		return false, apierror.FromResponse(apierror.LunchMoney, resp)
 	}
 
 	var response struct {
@@ -82,6 +132,11 @@ func (c *Client) VerifyAssetExist(assetID int64) (bool, error) {
 }
 
 func (c *Client) AddTransactions(transactions []models.LunchMoneyTransaction) (transactionIDs []string, err error) {
+	return c.AddTransactionsContext(context.Background(), transactions)
+}
+
+// AddTransactionsContext is AddTransactions with ctx attached to every request.
+func (c *Client) AddTransactionsContext(ctx context.Context, transactions []models.LunchMoneyTransaction) (transactionIDs []string, err error) {
 	if len(transactions) == 0 {
 		return []string{}, fmt.Errorf("no transactions to add")
 	}
@@ -94,6 +149,9 @@ func (c *Client) AddTransactions(transactions []models.LunchMoneyTransaction) (t
 		if tx.Amount == "" {
 			return []string{}, fmt.Errorf("transaction[%d]: amount is required", i)
 		}
+		if err := c.checkNoteLength(tx.Notes); err != nil {
+			return []string{}, fmt.Errorf("transaction[%d]: %w", i, err)
+		}
 	}
 
 	requestBody := struct {
@@ -109,10 +167,15 @@ func (c *Client) AddTransactions(transactions []models.LunchMoneyTransaction) (t
 		return []string{}, fmt.Errorf("failed to marshal request body: %w", err)
 	}
 
-	req, err := c.newRequest("POST", "/transactions", bytes.NewReader(jsonData))
+	req, err := c.newRequest(ctx, "POST", "/transactions", bytes.NewReader(jsonData))
 	if err != nil {
 		return []string{}, err
 	}
+	if hasExternalIDs(transactions) {
+		// Lunch Money rejects a second transaction with the same external ID
+		// in an asset, so a retried insert can't duplicate
+		req = req.WithContext(httpretry.MarkIdempotent(req.Context()))
+	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -125,8 +188,7 @@ func (c *Client) AddTransactions(transactions []models.LunchMoneyTransaction) (t
 	// https://lunchmoney.dev/#insert-transactions
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return []string{}, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+		return []string{}, apierror.FromResponse(apierror.LunchMoney, resp)
 	}
 
 	var responseBody struct {
@@ -139,18 +201,43 @@ func (c *Client) AddTransactions(transactions []models.LunchMoneyTransaction) (t
 	}
 
 	if len(responseBody.Error) > 0 {
-		return []string{}, fmt.Errorf("API error: %v", responseBody.Error)
+		return []string{}, listedError(resp, responseBody.Error)
 	}
 
 	return responseBody.IDs, nil
 }
 
+// listedError reports the errors Lunch Money lists in the body of a 200.
+func listedError(resp *http.Response, messages []string) error {
+	return &apierror.Error{
+		Service:    apierror.LunchMoney,
+		Method:     resp.Request.Method,
+		Endpoint:   resp.Request.URL.Path,
+		StatusCode: resp.StatusCode,
+		Errors:     messages,
+	}
+}
+
+func hasExternalIDs(transactions []models.LunchMoneyTransaction) bool {
+	for _, tx := range transactions {
+		if tx.ExternalID == "" || tx.AssetID == 0 {
+			return false
+		}
+	}
+	return true
+}
+
 func (c *Client) GetTransactionByID(transactionID int64) (models.LunchMoneyTransaction, error) {
+	return c.GetTransactionByIDContext(context.Background(), transactionID)
+}
+
+// GetTransactionByIDContext is GetTransactionByID with ctx attached to every request.
+func (c *Client) GetTransactionByIDContext(ctx context.Context, transactionID int64) (models.LunchMoneyTransaction, error) {
 	if transactionID <= 0 {
 		return models.LunchMoneyTransaction{}, fmt.Errorf("invalid transaction ID: %d", transactionID)
 	}
 
-	req, err := c.newRequest("GET", "/transaction/"+fmt.Sprint(transactionID), nil)
+	req, err := c.newRequest(ctx, "GET", "/transaction/"+fmt.Sprint(transactionID), nil)
 	if err != nil {
 		return models.LunchMoneyTransaction{}, err
 	}
@@ -162,8 +249,7 @@ func (c *Client) GetTransactionByID(transactionID int64) (models.LunchMoneyTrans
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return models.LunchMoneyTransaction{}, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+		return models.LunchMoneyTransaction{}, apierror.FromResponse(apierror.LunchMoney, resp)
 	}
 
 	var transaction models.LunchMoneyTransaction
@@ -175,8 +261,13 @@ func (c *Client) GetTransactionByID(transactionID int64) (models.LunchMoneyTrans
 }
 
 func (c *Client) GetTransactions(startDate string, endDate string, assetID int64, tag string) ([]models.LunchMoneyTransaction, error) {
+	return c.GetTransactionsContext(context.Background(), startDate, endDate, assetID, tag)
+}
+
+// GetTransactionsContext is GetTransactions with ctx attached to every request.
+func (c *Client) GetTransactionsContext(ctx context.Context, startDate string, endDate string, assetID int64, tag string) ([]models.LunchMoneyTransaction, error) {
 	if tag != "" {
-		_, err := c.getTagID(tag)
+		_, err := c.getTagID(ctx, tag)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get tag ID: %w", err)
 		}
@@ -232,7 +323,7 @@ func (c *Client) GetTransactions(startDate string, endDate string, assetID int64
 
 		endpoint := "/transactions?" + params.Encode()
 
-		req, err := c.newRequest("GET", endpoint, nil)
+		req, err := c.newRequest(ctx, "GET", endpoint, nil)
 		if err != nil {
 			return nil, fmt.Errorf("creating request failed: %w", err)
 		}
@@ -244,8 +335,7 @@ func (c *Client) GetTransactions(startDate string, endDate string, assetID int64
 		defer resp.Body.Close()
 
 		if resp.StatusCode != http.StatusOK {
-			body, _ := io.ReadAll(resp.Body)
-			return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+			return nil, apierror.FromResponse(apierror.LunchMoney, resp)
 		}
 
 		if err := json.NewDecoder(resp.Body).Decode(&pageResp); err != nil {
@@ -260,12 +350,12 @@ func (c *Client) GetTransactions(startDate string, endDate string, assetID int64
 	return allTransactions, nil
 }
 
-func (c *Client) getTagID(tag string) (tagID int64, err error) {
+func (c *Client) getTagID(ctx context.Context, tag string) (tagID int64, err error) {
 	if tag == "" {
 		return 0, fmt.Errorf("tag cannot be empty")
 	}
 
-	req, err := c.newRequest("GET", "/tags", nil)
+	req, err := c.newRequest(ctx, "GET", "/tags", nil)
 	if err != nil {
 		return 0, fmt.Errorf("creating request failed: %w", err)
 	}
@@ -277,8 +367,7 @@ func (c *Client) getTagID(tag string) (tagID int64, err error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return 0, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+		return 0, apierror.FromResponse(apierror.LunchMoney, resp)
 	}
 
 	var tagsResp []models.LunchMoneyTag
@@ -296,10 +385,18 @@ func (c *Client) getTagID(tag string) (tagID int64, err error) {
 }
 
 func (c *Client) UpdateTransaction(transactionID int64, updatedTransaction models.LunchMoneyTransaction) error {
+	return c.UpdateTransactionContext(context.Background(), transactionID, updatedTransaction)
+}
+
+// UpdateTransactionContext is UpdateTransaction with ctx attached to every request.
+func (c *Client) UpdateTransactionContext(ctx context.Context, transactionID int64, updatedTransaction models.LunchMoneyTransaction) error {
 
 	if transactionID <= 0 {
 		return fmt.Errorf("invalid transaction ID: %d", transactionID)
 	}
+	if err := c.checkNoteLength(updatedTransaction.Notes); err != nil {
+		return err
+	}
 
 	requestBody := struct {
 		Transaction     models.LunchMoneyTransaction `json:"transaction"`
@@ -314,7 +411,7 @@ func (c *Client) UpdateTransaction(transactionID int64, updatedTransaction model
 		return fmt.Errorf("failed to marshal request body: %w", err)
 	}
 
-	req, err := c.newRequest("PUT", "/transaction/"+fmt.Sprint(transactionID), bytes.NewReader(jsonData))
+	req, err := c.newRequest(ctx, "PUT", "/transaction/"+fmt.Sprint(transactionID), bytes.NewReader(jsonData))
 	if err != nil {
 		return fmt.Errorf("creating request failed: %w", err)
 	}
@@ -326,8 +423,7 @@ func (c *Client) UpdateTransaction(transactionID int64, updatedTransaction model
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+		return apierror.FromResponse(apierror.LunchMoney, resp)
 	}
 
 	var transactionResp struct {
@@ -339,7 +435,7 @@ func (c *Client) UpdateTransaction(transactionID int64, updatedTransaction model
 	}
 
 	if len(transactionResp.Error) > 0 {
-		return fmt.Errorf("API error: %v", transactionResp.Error)
+		return listedError(resp, transactionResp.Error)
 	}
 
 	if !transactionResp.Updated {
@@ -349,14 +445,40 @@ func (c *Client) UpdateTransaction(transactionID int64, updatedTransaction model
 	return nil
 }
 
-func (c *Client) DeleteTransaction() error {
-	// will come back to this later
+// DeleteTransaction hard deletes a transaction. Lunch Money's v1 API doesn't
+// document a single-transaction delete, so callers should be ready for this to
+// fail and fall back to zeroing the transaction out with UpdateTransaction.
+func (c *Client) DeleteTransaction(transactionID int64) error {
+	return c.DeleteTransactionContext(context.Background(), transactionID)
+}
+
+// DeleteTransactionContext is DeleteTransaction with ctx attached to every request.
+func (c *Client) DeleteTransactionContext(ctx context.Context, transactionID int64) error {
+	if transactionID <= 0 {
+		return fmt.Errorf("invalid transaction ID: %d", transactionID)
+	}
+
+	req, err := c.newRequest(ctx, "DELETE", "/transaction/"+fmt.Sprint(transactionID), nil)
+	if err != nil {
+		return fmt.Errorf("creating request failed: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("performing request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return apierror.FromResponse(apierror.LunchMoney, resp)
+	}
+
 	return nil
 }
 
 func (c *Client) checkNoteLength(notes string) error {
-	if len(notes) > 350 {
-		return fmt.Errorf("notes exceed maximum length of 255 characters")
+	if utf8.RuneCountInString(notes) > MaxNotesLength {
+		return fmt.Errorf("notes exceed maximum length of %d characters", MaxNotesLength)
 	}
 	return nil
 }
@@ -1,13 +1,18 @@
 package lunchmoney
 
 import (
+	"context"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"strconv"
 	"strings"
 	"testing"
 
+	"github.com/jasmineyas/splitwise-lunchmoney/apierror"
+	"github.com/jasmineyas/splitwise-lunchmoney/httpretry"
 	"github.com/jasmineyas/splitwise-lunchmoney/models"
 )
 
@@ -303,7 +308,7 @@ func TestAddTransactions(t *testing.T) {
 			mockResponse:    `{"error": "Invalid access token"}`,
 			wantIDs:         []string{},
 			wantErr:         true,
-			wantErrContains: "API request failed with status 401",
+			wantErrContains: "API error (status 401)",
 		},
 		{
 			name: "server error",
@@ -320,7 +325,7 @@ func TestAddTransactions(t *testing.T) {
 			mockResponse:    `{"error": "Internal server error"}`,
 			wantIDs:         []string{},
 			wantErr:         true,
-			wantErrContains: "API request failed with status 500",
+			wantErrContains: "API error (status 500)",
 		},
 		{
 			name: "unauthorized",
@@ -434,6 +439,121 @@ func TestAddTransactions(t *testing.T) {
 	}
 }
 
+func TestAddTransactionsRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		transaction  models.LunchMoneyTransaction
+		wantErr      bool
+		wantRequests int
+	}{
+		{
+			name: "external ID makes the insert safe to retry",
+			transaction: models.LunchMoneyTransaction{
+				Date: "2025-12-23", Amount: "50.00", AssetID: 234273, ExternalID: "splitwise-4096669090",
+			},
+			wantRequests: 2,
+		},
+		{
+			name: "no external ID is sent once",
+			transaction: models.LunchMoneyTransaction{
+				Date: "2025-12-23", Amount: "50.00", AssetID: 234273,
+			},
+			wantErr:      true,
+			wantRequests: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requestCount := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requestCount++
+				if requestCount == 1 {
+					w.Header().Set("Retry-After", "0")
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(`{"ids": ["12345"]}`))
+			}))
+			defer server.Close()
+
+			client := &Client{
+				httpClient:  &http.Client{Transport: httpretry.New(nil)},
+				baseURL:     server.URL,
+				bearerToken: "test-token",
+			}
+
+			_, err := client.AddTransactions([]models.LunchMoneyTransaction{tt.transaction})
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("AddTransactions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if requestCount != tt.wantRequests {
+				t.Errorf("expected %d requests, got %d", tt.wantRequests, requestCount)
+			}
+		})
+	}
+}
+
+func TestAddTransactionsAPIError(t *testing.T) {
+	tests := []struct {
+		name             string
+		mockStatus       int
+		mockResponse     string
+		wantStatus       int
+		wantErrors       []string
+		wantUnauthorized bool
+	}{
+		{
+			name:         "errors listed in a 200",
+			mockStatus:   http.StatusOK,
+			mockResponse: `{"error": ["Transaction 0 has an invalid currency: djd"]}`,
+			wantStatus:   http.StatusOK,
+			wantErrors:   []string{"Transaction 0 has an invalid currency: djd"},
+		},
+		{
+			name:             "unauthorized",
+			mockStatus:       http.StatusUnauthorized,
+			mockResponse:     `{"error": "Access token does not exist."}`,
+			wantStatus:       http.StatusUnauthorized,
+			wantErrors:       []string{"Access token does not exist."},
+			wantUnauthorized: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.mockStatus)
+				w.Write([]byte(tt.mockResponse))
+			}))
+			defer server.Close()
+
+			client := &Client{httpClient: &http.Client{}, baseURL: server.URL, bearerToken: "test-token"}
+
+			_, err := client.AddTransactions([]models.LunchMoneyTransaction{{Date: "2025-12-23", Amount: "50.00", Currency: "djd"}})
+
+			var apiErr *apierror.Error
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("expected *apierror.Error, got %T: %v", err, err)
+			}
+			if apiErr.StatusCode != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, apiErr.StatusCode)
+			}
+			if apiErr.Endpoint != "/transactions" || apiErr.Method != http.MethodPost {
+				t.Errorf("expected POST /transactions, got %s %s", apiErr.Method, apiErr.Endpoint)
+			}
+			if !slices.Equal(apiErr.Errors, tt.wantErrors) {
+				t.Errorf("expected errors %q, got %q", tt.wantErrors, apiErr.Errors)
+			}
+			if apiErr.Unauthorized() != tt.wantUnauthorized {
+				t.Errorf("expected Unauthorized() %v, got %v", tt.wantUnauthorized, apiErr.Unauthorized())
+			}
+		})
+	}
+}
+
 func TestGetTransactionByID(t *testing.T) {
 	tests := []struct {
 		name            string
@@ -450,6 +570,7 @@ func TestGetTransactionByID(t *testing.T) {
 			mockStatus:    http.StatusOK,
 			expectedPath:  "/transaction/12345",
 			mockResponse: `{
+				"id": 12345,
 				"date": "2025-12-23",
 				"amount": "50.00",
 				"payee": "Test Payee",
@@ -479,7 +600,7 @@ func TestGetTransactionByID(t *testing.T) {
 			expectedPath:    "/transaction/999999",
 			mockResponse:    `{"error": "Transaction not found"}`,
 			wantErr:         true,
-			wantErrContains: "API request failed with status 404",
+			wantErrContains: "API error (status 404)",
 		},
 		{
 			name:            "unauthorized",
@@ -488,7 +609,7 @@ func TestGetTransactionByID(t *testing.T) {
 			expectedPath:    "/transaction/12345",
 			mockResponse:    `{"error": "Invalid access token"}`,
 			wantErr:         true,
-			wantErrContains: "API request failed with status 401",
+			wantErrContains: "API error (status 401)",
 		},
 		{
 			name:            "server error",
@@ -497,7 +618,7 @@ func TestGetTransactionByID(t *testing.T) {
 			expectedPath:    "/transaction/12345",
 			mockResponse:    `{"error": "Internal server error"}`,
 			wantErr:         true,
-			wantErrContains: "API request failed with status 500",
+			wantErrContains: "API error (status 500)",
 		},
 	}
 
@@ -548,6 +669,9 @@ func TestGetTransactionByID(t *testing.T) {
 			if !tt.wantErr && transaction.Date == "" {
 				t.Error("expected non-empty transaction, got empty")
 			}
+			if !tt.wantErr && transaction.ID != tt.transactionID {
+				t.Errorf("expected transaction ID %d, got %d", tt.transactionID, transaction.ID)
+			}
 		})
 	}
 }
@@ -771,6 +895,64 @@ func TestGetTransactions(t *testing.T) {
 	}
 }
 
+func TestGetTransactionsExternalID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{
+			"transactions": [
+				{
+					"id": 2212330451,
+					"date": "2025-10-11",
+					"amount": "-17.8600",
+					"category_id": null,
+					"asset_id": 234273,
+					"external_id": "splitwise-4096669090",
+					"tags": [{"id": 91, "name": "Splitwise-lunchmoney-sync"}]
+				},
+				{
+					"id": 2212330452,
+					"date": "2025-10-12",
+					"amount": "12.0000",
+					"category_id": 7,
+					"asset_id": 234273,
+					"external_id": null,
+					"tags": null
+				}
+			],
+			"has_more": false
+		}`))
+	}))
+	defer server.Close()
+
+	client := &Client{
+		httpClient:  &http.Client{},
+		baseURL:     server.URL,
+		bearerToken: "test-token",
+	}
+
+	transactions, err := client.GetTransactions("2025-10-01", "2025-10-31", 234273, "")
+	if err != nil {
+		t.Fatalf("GetTransactions() error = %v", err)
+	}
+	if len(transactions) != 2 {
+		t.Fatalf("GetTransactions() returned %d transactions, want 2", len(transactions))
+	}
+
+	got := transactions[0]
+	if got.ID != 2212330451 {
+		t.Errorf("expected ID 2212330451, got %d", got.ID)
+	}
+	if got.ExternalID != "splitwise-4096669090" {
+		t.Errorf("expected external ID splitwise-4096669090, got %q", got.ExternalID)
+	}
+	if len(got.Tags) != 1 || got.Tags[0] != "Splitwise-lunchmoney-sync" {
+		t.Errorf("expected tags [Splitwise-lunchmoney-sync], got %v", got.Tags)
+	}
+	if transactions[1].CategoryID != 7 {
+		t.Errorf("expected category ID 7, got %d", transactions[1].CategoryID)
+	}
+}
+
 func TestUpdateTransaction(t *testing.T) {
 	tests := []struct {
 		name               string
@@ -822,6 +1004,29 @@ func TestUpdateTransaction(t *testing.T) {
 			wantErr:         true,
 			wantErrContains: "invalid transaction ID",
 		},
+		{
+			name:          "notes too long",
+			transactionID: 12345,
+			updatedTransaction: models.LunchMoneyTransaction{
+				Date:   "2025-12-23",
+				Amount: "0.00",
+				Notes:  strings.Repeat("é", 351),
+			},
+			wantErr:         true,
+			wantErrContains: "notes exceed maximum length of 350 characters",
+		},
+		{
+			name:          "notes at the limit",
+			transactionID: 12345,
+			updatedTransaction: models.LunchMoneyTransaction{
+				Date:   "2025-12-23",
+				Amount: "0.00",
+				Notes:  strings.Repeat("é", 350),
+			},
+			mockStatus:   http.StatusOK,
+			expectedPath: "/transaction/12345",
+			mockResponse: `{"updated": true}`,
+		},
 		{
 			name:          "invalid transaction ID - negative",
 			transactionID: -1,
@@ -1051,7 +1256,7 @@ func TestGetTagID(t *testing.T) {
 				bearerToken: "test-token",
 			}
 
-			tagID, err := client.getTagID(tt.tag)
+			tagID, err := client.getTagID(context.Background(), tt.tag)
 
 			if (err != nil) != tt.wantErr {
 				t.Errorf("getTagID() error = %v, wantErr %v", err, tt.wantErr)
@@ -1072,3 +1277,107 @@ func TestGetTagID(t *testing.T) {
 		})
 	}
 }
+
+func TestDeleteTransaction(t *testing.T) {
+	tests := []struct {
+		name            string
+		transactionID   int64
+		mockResponse    string
+		mockStatus      int
+		expectedPath    string
+		wantErr         bool
+		wantErrContains string
+	}{
+		{
+			name:          "successful delete",
+			transactionID: 12345,
+			mockStatus:    http.StatusOK,
+			expectedPath:  "/transaction/12345",
+			mockResponse:  `{}`,
+			wantErr:       false,
+		},
+		{
+			name:          "successful delete - no content",
+			transactionID: 12345,
+			mockStatus:    http.StatusNoContent,
+			expectedPath:  "/transaction/12345",
+			wantErr:       false,
+		},
+		{
+			name:            "invalid transaction ID - zero",
+			transactionID:   0,
+			wantErr:         true,
+			wantErrContains: "invalid transaction ID",
+		},
+		{
+			name:            "invalid transaction ID - negative",
+			transactionID:   -1,
+			wantErr:         true,
+			wantErrContains: "invalid transaction ID",
+		},
+		{
+			name:            "transaction not found",
+			transactionID:   999999,
+			mockStatus:      http.StatusNotFound,
+			expectedPath:    "/transaction/999999",
+			mockResponse:    `{"error": "Transaction not found"}`,
+			wantErr:         true,
+			wantErrContains: "API error (status 404)",
+		},
+		{
+			name:            "method not allowed",
+			transactionID:   12345,
+			mockStatus:      http.StatusMethodNotAllowed,
+			expectedPath:    "/transaction/12345",
+			mockResponse:    `{"error": "Method not allowed"}`,
+			wantErr:         true,
+			wantErrContains: "API error (status 405)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.expectedPath != "" {
+					if r.URL.Path != tt.expectedPath {
+						t.Errorf("expected path %s, got %s", tt.expectedPath, r.URL.Path)
+					}
+
+					if r.Method != "DELETE" {
+						t.Errorf("expected DELETE request, got %s", r.Method)
+					}
+
+					auth := r.Header.Get("Authorization")
+					if auth != "Bearer test-token" {
+						t.Errorf("expected Bearer test-token, got %s", auth)
+					}
+				}
+
+				w.WriteHeader(tt.mockStatus)
+				w.Write([]byte(tt.mockResponse))
+			}))
+			defer server.Close()
+
+			client := &Client{
+				httpClient:  &http.Client{},
+				baseURL:     server.URL,
+				bearerToken: "test-token",
+			}
+
+			err := client.DeleteTransaction(tt.transactionID)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DeleteTransaction() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErr && tt.wantErrContains != "" {
+				if err == nil {
+					t.Errorf("expected error containing %q, got nil", tt.wantErrContains)
+				} else if !containsString(err.Error(), tt.wantErrContains) {
+					t.Errorf("expected error containing %q, got %q", tt.wantErrContains, err.Error())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ParseCents converts a decimal amount string ("17.8", "-310.60") into integer
+// cents so sums across repayments don't accumulate float rounding errors.
+func ParseCents(amount string) (int64, error) {
+	amount = strings.TrimSpace(amount)
+	if amount == "" {
+		return 0, fmt.Errorf("empty amount")
+	}
+
+	f, err := strconv.ParseFloat(amount, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q: %w", amount, err)
+	}
+
+	return int64(math.Round(f * 100)), nil
+}
+
+// FormatCents renders cents as a fixed two-decimal string, e.g. -1786 -> "-17.86".
+func FormatCents(cents int64) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
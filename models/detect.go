@@ -4,14 +4,16 @@ package models
 type UpdateAction struct {
 	ExpenseID       int64
 	Expense         SplitwiseExpense
-	ChangedFields   []string // e.g., ["amount", "description", "repayments"]
-	OldHash         string   // Previous snapshot hash
-	NewHash         string   // Current snapshot hash
-	LunchMoneyTxnID string   // Existing LM transaction to update
+	ChangedFields   []string     // e.g., ["amount", "description", "repayments"]
+	OldHash         string       // Previous snapshot hash
+	NewHash         string       // Current snapshot hash
+	LunchMoneyTxnID string       // Existing LM transaction to update
+	SyncData        SyncMetadata // Metadata from the latest sync comment
 }
 
 // DeleteAction - just identifiers needed to delete
 type DeleteAction struct {
 	ExpenseID       int64
-	LunchMoneyTxnID string // LM transaction ID to delete
+	LunchMoneyTxnID string       // LM transaction ID to delete
+	SyncData        SyncMetadata // Metadata from the latest sync comment
 }
@@ -1,14 +1,53 @@
 package models
 
+import "encoding/json"
+
 type LunchMoneyTransaction struct {
-	Date     string   `json:"date"`
-	Amount   string   `json:"amount"`
-	Payee    string   `json:"payee"`
-	Currency string   `json:"currency"`
-	AssetID  int64    `json:"asset_id,omitempty"`
-	Notes    string   `json:"notes"`
-	Status   string   `json:"status"`
-	Tags     []string `json:"tags"`
+	ID         int64    `json:"id,omitempty"`
+	Date       string   `json:"date"`
+	Amount     string   `json:"amount"`
+	Payee      string   `json:"payee"`
+	Currency   string   `json:"currency"`
+	AssetID    int64    `json:"asset_id,omitempty"`
+	CategoryID int64    `json:"category_id,omitempty"`
+	Notes      string   `json:"notes"`
+	Status     string   `json:"status,omitempty"`
+	ExternalID string   `json:"external_id,omitempty"`
+	Tags       []string `json:"tags"`
+}
+
+// UnmarshalJSON accepts tags both as the names we send on insert and as the
+// {"id", "name"} objects Lunch Money returns when reading transactions.
+func (t *LunchMoneyTransaction) UnmarshalJSON(data []byte) error {
+	type transaction LunchMoneyTransaction
+	var raw struct {
+		transaction
+		Tags json.RawMessage `json:"tags"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*t = LunchMoneyTransaction(raw.transaction)
+	t.Tags = nil
+	if len(raw.Tags) == 0 || string(raw.Tags) == "null" {
+		return nil
+	}
+
+	var names []string
+	if err := json.Unmarshal(raw.Tags, &names); err == nil {
+		t.Tags = names
+		return nil
+	}
+
+	var tags []LunchMoneyTag
+	if err := json.Unmarshal(raw.Tags, &tags); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		t.Tags = append(t.Tags, tag.Name)
+	}
+	return nil
 }
 
 type LunchMoneyTag struct {
@@ -3,15 +3,31 @@ package models
 import "time"
 
 type SplitwiseExpense struct {
-	ID          int64         `json:"id"`
-	Description string        `json:"description"`
-	Cost        string        `json:"cost"`
-	Date        time.Time     `json:"date"`
-	Currency    string        `json:"currency_code"`
-	Repayments  []Repayment   `json:"repayments"`
-	DeletedAt   *time.Time    `json:"deleted_at"`
-	DeletedBy   *User         `json:"deleted_by"`
-	Users       []ExpenseUser `json:"users"`
+	ID             int64         `json:"id"`
+	GroupID        *int64        `json:"group_id"`
+	Description    string        `json:"description"`
+	Cost           string        `json:"cost"`
+	Date           time.Time     `json:"date"`
+	Currency       string        `json:"currency_code"`
+	CreationMethod string        `json:"creation_method"` // "payment" for settle-ups
+	Payment        bool          `json:"payment"`
+	Category       Category      `json:"category"`
+	Receipt        Receipt       `json:"receipt"`
+	Repayments     []Repayment   `json:"repayments"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+	DeletedAt      *time.Time    `json:"deleted_at"`
+	DeletedBy      *User         `json:"deleted_by"`
+	Users          []ExpenseUser `json:"users"`
+}
+
+type Category struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type Receipt struct {
+	Large    *string `json:"large"`
+	Original *string `json:"original"`
 }
 
 type Repayment struct {
@@ -3,10 +3,11 @@ package models
 import "time"
 
 type SyncMetadata struct {
-	SplitwiseExpenseID int64     `json:"splitwise_expense_id"`
-	SnapshotHash       string    `json:"snapshot_hash"` // For change detection
-	SyncedAt           time.Time `json:"synced_at"`
-	SyncedBy           int64     `json:"synced_by_user_id"` // Who posted this comment
+	SplitwiseExpenseID int64            `json:"splitwise_expense_id"`
+	SnapshotHash       string           `json:"snapshot_hash"` // For change detection
+	Snapshot           *ExpenseSnapshot `json:"snapshot,omitempty"`
+	SyncedAt           time.Time        `json:"synced_at"`
+	SyncedBy           int64            `json:"synced_by_user_id"` // Who posted this comment
 
 	UserA UserSyncData `json:"user_a"`
 	UserB UserSyncData `json:"user_b"`
@@ -23,6 +24,41 @@ type UserSyncData struct {
 }
 
 type DeletionMetadata struct {
-	DeletedFromLMAt time.Time `json:"deleted_from_lm_at"`
-	DeletedBy       int64     `json:"deleted_by_user_id"`
+	SplitwiseExpenseID int64     `json:"splitwise_expense_id"`
+	DeletedFromLMAt    time.Time `json:"deleted_from_lm_at"`
+	DeletedBy          int64     `json:"deleted_by_user_id"`
+	Mode               string    `json:"mode"` // "zero" or "delete"
+
+	UserA UserSyncData `json:"user_a"`
+	UserB UserSyncData `json:"user_b"`
+}
+
+// ExpenseState is everything the sync has recorded for one Splitwise
+// expense: the latest sync and the latest removal from Lunch Money, each
+// with when it was recorded. Legacy expenses predate the sync and are left
+// alone.
+type ExpenseState struct {
+	Sync      *SyncMetadata     `json:"sync,omitempty"`
+	SyncedAt  time.Time         `json:"synced_at,omitzero"`
+	Deletion  *DeletionMetadata `json:"deletion,omitempty"`
+	DeletedAt time.Time         `json:"deleted_at,omitzero"`
+	Legacy    bool              `json:"legacy,omitempty"`
+}
+
+// ExpenseSnapshot is the canonical form of the Splitwise expense fields that
+// matter to Lunch Money. It is hashed for change detection and kept in the
+// sync comment so later runs can tell which fields changed.
+type ExpenseSnapshot struct {
+	Cost        string          `json:"cost"`
+	Date        string          `json:"date"`
+	Currency    string          `json:"currency"`
+	Description string          `json:"description"`
+	Repayments  []Repayment     `json:"repayments"`
+	Shares      []ShareSnapshot `json:"shares"`
+}
+
+type ShareSnapshot struct {
+	UserID    int64  `json:"user_id"`
+	PaidShare string `json:"paid_share"`
+	OwedShare string `json:"owed_share"`
 }
@@ -0,0 +1,134 @@
+// Startup checks that the tokens, users and assets in the config fit together
+
+package preflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jasmineyas/splitwise-lunchmoney/apierror"
+	"github.com/jasmineyas/splitwise-lunchmoney/config"
+	"github.com/jasmineyas/splitwise-lunchmoney/lunchmoney"
+	"github.com/jasmineyas/splitwise-lunchmoney/models"
+	"github.com/jasmineyas/splitwise-lunchmoney/splitwise"
+)
+
+// SplitwiseAPI is the part of the Splitwise client the checks use.
+type SplitwiseAPI interface {
+	GetUserInfoContext(ctx context.Context) (*models.User, error)
+	GetFriendContext(ctx context.Context, friendID int64) (*models.User, error)
+}
+
+// LunchMoneyAPI is the part of a Lunch Money client the checks use.
+type LunchMoneyAPI interface {
+	VerifyAssetExistContext(ctx context.Context, assetID int64) (bool, error)
+}
+
+var (
+	_ SplitwiseAPI  = (*splitwise.Client)(nil)
+	_ LunchMoneyAPI = (*lunchmoney.Client)(nil)
+)
+
+// Check is the outcome of one check. Err says what is wrong and what to
+// change; Detail says what was found when it passed.
+type Check struct {
+	Name   string
+	Detail string
+	Err    error
+}
+
+// Report is what Run found. User is the authenticated Splitwise user, user A,
+// whose perspective everything is synced from.
+type Report struct {
+	User   models.User
+	Friend models.User
+	Checks []Check
+}
+
+// Err joins the failed checks, nil when everything passed.
+func (r Report) Err() error {
+	var errs []error
+	for _, check := range r.Checks {
+		if check.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", check.Name, check.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Run checks that the Splitwise token works and belongs to user A, that user
+// B is their friend, and that each Lunch Money token works and can see its
+// Splitwise asset. Every check runs, so one pass shows everything to fix.
+func Run(ctx context.Context, cfg *config.Config, sw SplitwiseAPI, lmA, lmB LunchMoneyAPI) Report {
+	var report Report
+
+	user, err := sw.GetUserInfoContext(ctx)
+	switch {
+	case apierror.IsUnauthorized(err):
+		report.add("Splitwise token", "", fmt.Errorf("rejected by Splitwise; create a new API key and set %s", setting("splitwise.bearer_token", "USER_A_SPLITWISE_BEARER_TOKEN")))
+	case err != nil:
+		report.add("Splitwise token", "", fmt.Errorf("could not check it: %w", err))
+	case user.ID == cfg.UserBSplitwiseID:
+		report.add("Splitwise token", "", fmt.Errorf("belongs to user B (%s); the sync runs as user A, so set %s to user A's token",
+			describe(*user), setting("splitwise.bearer_token", "USER_A_SPLITWISE_BEARER_TOKEN")))
+	default:
+		report.User = *user
+		report.add("Splitwise token", "authenticated as "+describe(*user), nil)
+	}
+
+	// the friend lookup needs a working token belonging to user A
+	if report.User.ID != 0 {
+		friend, err := sw.GetFriendContext(ctx, cfg.UserBSplitwiseID)
+		switch {
+		case apierror.IsNotFound(err):
+			report.add("Splitwise friend", "", fmt.Errorf("user %d is not a Splitwise friend of %s; check %s",
+				cfg.UserBSplitwiseID, describe(report.User), setting("splitwise.friend_id", "USER_B_SPLITWISE_ID")))
+		case err != nil:
+			report.add("Splitwise friend", "", fmt.Errorf("could not check user %d: %w", cfg.UserBSplitwiseID, err))
+		default:
+			report.Friend = *friend
+			report.add("Splitwise friend", "user B is "+describe(*friend), nil)
+		}
+	}
+
+	report.checkAsset(ctx, "Lunch Money user A", "user_a", "USER_A", lmA, cfg.UserALunchMoney.SplitwiseAccountAssetID)
+	report.checkAsset(ctx, "Lunch Money user B", "user_b", "USER_B", lmB, cfg.UserBLunchMoney.SplitwiseAccountAssetID)
+
+	return report
+}
+
+func (r *Report) checkAsset(ctx context.Context, name, key, env string, lm LunchMoneyAPI, assetID int64) {
+	found, err := lm.VerifyAssetExistContext(ctx, assetID)
+	switch {
+	case apierror.IsUnauthorized(err):
+		r.add(name, "", fmt.Errorf("token rejected by Lunch Money; create a new access token and set %s",
+			setting("lunchmoney."+key+".bearer_token", env+"_LUNCHMONEY_BEARER_TOKEN")))
+	case err != nil:
+		r.add(name, "", fmt.Errorf("could not check asset %d: %w", assetID, err))
+	case !found:
+		r.add(name, "", fmt.Errorf("asset %d is not in this Lunch Money budget; check %s",
+			assetID, setting("lunchmoney."+key+".asset_id", env+"_LUNCHMONEY_SPLITWISE_ACCOUNT_ASSET_ID")))
+	default:
+		r.add(name, fmt.Sprintf("asset %d found", assetID), nil)
+	}
+}
+
+func (r *Report) add(name, detail string, err error) {
+	r.Checks = append(r.Checks, Check{Name: name, Detail: detail, Err: err})
+}
+
+// setting names a config value both ways it can be set.
+func setting(key, env string) string {
+	return fmt.Sprintf("%s (config %s)", env, key)
+}
+
+// describe names a Splitwise user for the messages.
+func describe(user models.User) string {
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if name == "" {
+		return fmt.Sprintf("user %d", user.ID)
+	}
+	return fmt.Sprintf("%s (%d)", name, user.ID)
+}
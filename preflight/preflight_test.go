@@ -0,0 +1,124 @@
+package preflight
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jasmineyas/splitwise-lunchmoney/apierror"
+	"github.com/jasmineyas/splitwise-lunchmoney/config"
+	"github.com/jasmineyas/splitwise-lunchmoney/models"
+	"github.com/jasmineyas/splitwise-lunchmoney/syncEngine/fake"
+)
+
+const (
+	jasmineID = 9792490
+	wesleyID  = 50086667
+)
+
+var unauthorized = &apierror.Error{Service: apierror.Splitwise, StatusCode: http.StatusUnauthorized}
+
+type setup struct {
+	sw       *fake.Splitwise
+	lmA, lmB *fake.LunchMoney
+}
+
+// healthy is a setup every check passes.
+func healthy() setup {
+	sw := fake.NewSplitwise(jasmineID)
+	sw.User.FirstName = "Jasmine"
+	sw.Friends[wesleyID] = models.User{ID: wesleyID, FirstName: "Wesley", LastName: "Finck"}
+
+	lmA, lmB := fake.NewLunchMoney(), fake.NewLunchMoney()
+	lmA.Assets = []int64{111}
+	lmB.Assets = []int64{222, 333}
+	return setup{sw: sw, lmA: lmA, lmB: lmB}
+}
+
+func TestRun(t *testing.T) {
+	cfg := &config.Config{
+		UserBSplitwiseID: wesleyID,
+		UserALunchMoney:  config.LunchMoneyUserConfig{SplitwiseAccountAssetID: 111},
+		UserBLunchMoney:  config.LunchMoneyUserConfig{SplitwiseAccountAssetID: 222},
+	}
+
+	tests := []struct {
+		name       string
+		breakIt    func(s setup)
+		wantFailed map[string]string // check name -> part of its error
+		wantChecks int
+	}{
+		{
+			name:       "healthy",
+			breakIt:    func(setup) {},
+			wantChecks: 4,
+		},
+		{
+			name:       "splitwise token rejected",
+			breakIt:    func(s setup) { s.sw.Errs["GetUserInfo"] = unauthorized },
+			wantFailed: map[string]string{"Splitwise token": "USER_A_SPLITWISE_BEARER_TOKEN"},
+			wantChecks: 3, // no friend check without a user
+		},
+		{
+			name:       "token belongs to user B",
+			breakIt:    func(s setup) { s.sw.User.ID = wesleyID },
+			wantFailed: map[string]string{"Splitwise token": "belongs to user B"},
+			wantChecks: 3,
+		},
+		{
+			name:       "not a friend",
+			breakIt:    func(s setup) { delete(s.sw.Friends, wesleyID) },
+			wantFailed: map[string]string{"Splitwise friend": "USER_B_SPLITWISE_ID"},
+			wantChecks: 4,
+		},
+		{
+			name:       "lunch money token rejected",
+			breakIt:    func(s setup) { s.lmB.Errs["VerifyAssetExist"] = unauthorized },
+			wantFailed: map[string]string{"Lunch Money user B": "USER_B_LUNCHMONEY_BEARER_TOKEN"},
+			wantChecks: 4,
+		},
+		{
+			name: "assets swapped",
+			breakIt: func(s setup) {
+				s.lmA.Assets = []int64{222}
+				s.lmB.Assets = []int64{111}
+			},
+			wantFailed: map[string]string{
+				"Lunch Money user A": "USER_A_LUNCHMONEY_SPLITWISE_ACCOUNT_ASSET_ID",
+				"Lunch Money user B": "USER_B_LUNCHMONEY_SPLITWISE_ACCOUNT_ASSET_ID",
+			},
+			wantChecks: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := healthy()
+			tt.breakIt(s)
+
+			report := Run(context.Background(), cfg, s.sw, s.lmA, s.lmB)
+
+			if len(report.Checks) != tt.wantChecks {
+				t.Errorf("Run() ran %d checks, want %d: %+v", len(report.Checks), tt.wantChecks, report.Checks)
+			}
+			for _, check := range report.Checks {
+				want, shouldFail := tt.wantFailed[check.Name]
+				switch {
+				case shouldFail && check.Err == nil:
+					t.Errorf("check %q passed, want it to fail", check.Name)
+				case shouldFail && !strings.Contains(check.Err.Error(), want):
+					t.Errorf("check %q error = %q, want it to mention %q", check.Name, check.Err, want)
+				case !shouldFail && check.Err != nil:
+					t.Errorf("check %q failed: %v", check.Name, check.Err)
+				}
+			}
+			if (report.Err() != nil) != (len(tt.wantFailed) > 0) {
+				t.Errorf("Report.Err() = %v, want failure %v", report.Err(), len(tt.wantFailed) > 0)
+			}
+			if len(tt.wantFailed) == 0 && (report.User.ID != jasmineID || report.Friend.ID != wesleyID) {
+				t.Errorf("Run() user = %d, friend = %d, want %d and %d", report.User.ID, report.Friend.ID, jasmineID, wesleyID)
+			}
+		})
+	}
+}
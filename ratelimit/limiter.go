@@ -0,0 +1,161 @@
+// Client-side token bucket that slows down when the server pushes back
+
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jasmineyas/splitwise-lunchmoney/httpretry"
+)
+
+// Limiter is a token bucket safe for use by several goroutines. Every 429
+// halves the rate, down to a tenth of the configured one; every other
+// response wins back a tenth of the configured rate.
+type Limiter struct {
+	mu sync.Mutex
+
+	maxRate float64 // tokens per second as configured
+	minRate float64
+	rate    float64 // current tokens per second
+	burst   float64
+	tokens  float64
+	last    time.Time
+
+	stats Stats
+
+	// swapped out in tests
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// Stats is a snapshot of how much the limiter has held requests back.
+type Stats struct {
+	Requests  int64         // calls to Wait
+	Waits     int64         // calls that had to wait
+	Waited    time.Duration // total time spent waiting
+	Throttled int64         // 429s reported through Backoff
+	Rate      float64       // current requests per second
+}
+
+// New returns a limiter allowing ratePerSecond requests on average and up to
+// burst at once. A rate of zero or less never waits.
+func New(ratePerSecond float64, burst int) *Limiter {
+	burst = max(burst, 1)
+	return &Limiter{
+		maxRate: ratePerSecond,
+		minRate: ratePerSecond / 10,
+		rate:    ratePerSecond,
+		burst:   float64(burst),
+		tokens:  float64(burst),
+		now:     time.Now,
+		sleep:   httpretry.Sleep,
+	}
+}
+
+// Wait blocks until a request may be sent or ctx is done.
+func (l *Limiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	l.stats.Requests++
+	if l.maxRate <= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+
+	now := l.now()
+	l.refill(now)
+
+	// take the token now, even if it isn't there yet, so waiters queue up
+	// behind each other instead of all waking at once
+	l.tokens--
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+		l.stats.Waits++
+		l.stats.Waited += delay
+	}
+	l.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+	if err := l.sleep(ctx, delay); err != nil {
+		l.mu.Lock()
+		l.tokens++ // give back the token we didn't use
+		l.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (l *Limiter) refill(now time.Time) {
+	if !l.last.IsZero() {
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+}
+
+// Backoff records a 429 and halves the rate.
+func (l *Limiter) Backoff() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(l.now())
+	l.stats.Throttled++
+	l.rate = max(l.rate/2, l.minRate)
+}
+
+// Recover records a request the server accepted and creeps back towards the
+// configured rate.
+func (l *Limiter) Recover() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rate >= l.maxRate {
+		return
+	}
+	l.refill(l.now())
+	l.rate = min(l.rate+l.maxRate/10, l.maxRate)
+}
+
+// Stats returns the counters so far.
+func (l *Limiter) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stats := l.stats
+	stats.Rate = l.rate
+	return stats
+}
+
+// Transport makes every request wait for the limiter and feeds the response
+// status back into it. Put it under httpretry so retries are limited too.
+type Transport struct {
+	Base    http.RoundTripper
+	Limiter *Limiter
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.Limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		t.Limiter.Backoff()
+	} else {
+		t.Limiter.Recover()
+	}
+	return resp, nil
+}
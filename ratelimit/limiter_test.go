@@ -0,0 +1,171 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock advances only when the limiter sleeps.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	return ctx.Err()
+}
+
+func newTestLimiter(rate float64, burst int) (*Limiter, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2025, 12, 1, 8, 30, 0, 0, time.UTC)}
+	limiter := New(rate, burst)
+	limiter.now = clock.Now
+	limiter.sleep = clock.Sleep
+	return limiter, clock
+}
+
+func TestWait(t *testing.T) {
+	limiter, clock := newTestLimiter(2, 3)
+	start := clock.Now()
+
+	for i := 0; i < 7; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatalf("Wait() error = %v", err)
+		}
+	}
+
+	// 3 from the burst, then 4 more at 2 per second
+	if elapsed := clock.Now().Sub(start); elapsed != 2*time.Second {
+		t.Errorf("7 requests took %v, want 2s", elapsed)
+	}
+
+	stats := limiter.Stats()
+	if stats.Requests != 7 || stats.Waits != 4 {
+		t.Errorf("Stats() = %+v, want 7 requests and 4 waits", stats)
+	}
+	if stats.Waited < 2*time.Second {
+		t.Errorf("Stats().Waited = %v, want at least 2s", stats.Waited)
+	}
+}
+
+func TestWaitCancelled(t *testing.T) {
+	limiter, _ := newTestLimiter(1, 1)
+
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := limiter.Wait(ctx); err == nil {
+		t.Error("Wait() with cancelled context expected error")
+	}
+}
+
+func TestWaitUnlimited(t *testing.T) {
+	limiter, clock := newTestLimiter(0, 1)
+	start := clock.Now()
+
+	for i := 0; i < 100; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !clock.Now().Equal(start) {
+		t.Errorf("unlimited limiter waited %v", clock.Now().Sub(start))
+	}
+}
+
+func TestBackoffAndRecover(t *testing.T) {
+	limiter, _ := newTestLimiter(10, 1)
+
+	limiter.Backoff()
+	if rate := limiter.Stats().Rate; rate != 5 {
+		t.Errorf("rate after one 429 = %v, want 5", rate)
+	}
+
+	for i := 0; i < 10; i++ {
+		limiter.Backoff()
+	}
+	stats := limiter.Stats()
+	if stats.Rate != 1 {
+		t.Errorf("rate after many 429s = %v, want floor of 1", stats.Rate)
+	}
+	if stats.Throttled != 11 {
+		t.Errorf("Throttled = %d, want 11", stats.Throttled)
+	}
+
+	for i := 0; i < 20; i++ {
+		limiter.Recover()
+	}
+	if rate := limiter.Stats().Rate; rate != 10 {
+		t.Errorf("rate after recovering = %v, want 10", rate)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	statuses := []int{http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusOK}
+	requestCount := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(statuses[requestCount])
+		requestCount++
+	}))
+	defer server.Close()
+
+	limiter, _ := newTestLimiter(8, 10)
+	client := &http.Client{Transport: &Transport{Limiter: limiter}}
+
+	for range statuses {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	stats := limiter.Stats()
+	if stats.Requests != 4 {
+		t.Errorf("Requests = %d, want 4", stats.Requests)
+	}
+	if stats.Throttled != 2 {
+		t.Errorf("Throttled = %d, want 2", stats.Throttled)
+	}
+	// 8 -> 4 -> 2, then one success adds back 0.8
+	if stats.Rate != 2.8 {
+		t.Errorf("Rate = %v, want 2.8", stats.Rate)
+	}
+}
+
+func TestConcurrentWait(t *testing.T) {
+	limiter, clock := newTestLimiter(10, 1)
+	start := clock.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limiter.Wait(context.Background())
+		}()
+	}
+	wg.Wait()
+
+	if stats := limiter.Stats(); stats.Requests != 20 || stats.Waits != 19 {
+		t.Errorf("Stats() = %+v, want 20 requests and 19 waits", stats)
+	}
+	if clock.Now().Equal(start) {
+		t.Error("concurrent requests never waited")
+	}
+}
@@ -3,6 +3,8 @@
 package splitwise
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,13 +12,40 @@ import (
 	"net/url"
 	"time"
 
+	"github.com/jasmineyas/splitwise-lunchmoney/apierror"
+	"github.com/jasmineyas/splitwise-lunchmoney/httpretry"
 	"github.com/jasmineyas/splitwise-lunchmoney/models"
+	"github.com/jasmineyas/splitwise-lunchmoney/ratelimit"
+)
+
+// Splitwise doesn't publish its limits; this stays well clear of them.
+const (
+	DefaultRateLimit = 2.0 // requests per second
+	DefaultRateBurst = 5
 )
 
 type Client struct {
 	httpClient  *http.Client
 	baseURL     string
 	bearerToken string
+	limiter     *ratelimit.Limiter
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithRateLimit replaces the default rate limit.
+func WithRateLimit(ratePerSecond float64, burst int) Option {
+	return func(c *Client) {
+		c.limiter = ratelimit.New(ratePerSecond, burst)
+	}
+}
+
+// WithLimiter shares a limiter between clients using the same account.
+func WithLimiter(limiter *ratelimit.Limiter) Option {
+	return func(c *Client) {
+		c.limiter = limiter
+	}
 }
 
 type getCurrentUserResponse struct {
@@ -27,18 +56,32 @@ type getExpensesResponse struct {
 	Expenses []models.SplitwiseExpense `json:"expenses"`
 }
 
-func NewClient(bearerToken string) *Client {
-	return &Client{
-		httpClient:  &http.Client{Timeout: 60 * time.Second},
+func NewClient(bearerToken string, opts ...Option) *Client {
+	c := &Client{
 		baseURL:     "https://secure.splitwise.com/api/v3.0",
 		bearerToken: bearerToken,
+		limiter:     ratelimit.New(DefaultRateLimit, DefaultRateBurst),
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
+
+	// the limiter sits under the retries so every attempt waits its turn; no
+	// client Timeout, httpretry times out each attempt on its own
+	transport := httpretry.New(&ratelimit.Transport{Limiter: c.limiter})
+	c.httpClient = &http.Client{Transport: transport}
+	return c
+}
+
+// RateLimitStats reports how long requests have waited on the rate limiter.
+func (c *Client) RateLimitStats() ratelimit.Stats {
+	return c.limiter.Stats()
 }
 
-func (c *Client) newRequest(method, endpoint string, body io.Reader) (*http.Request, error) {
+func (c *Client) newRequest(ctx context.Context, method, endpoint string, body io.Reader) (*http.Request, error) {
 	url := c.baseURL + endpoint
 
-	req, err := http.NewRequest(method, url, body)
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		return nil, err
 	}
@@ -50,7 +93,12 @@ func (c *Client) newRequest(method, endpoint string, body io.Reader) (*http.Requ
 }
 
 func (c *Client) GetUserInfo() (*models.User, error) {
-	req, err := c.newRequest("GET", "/get_current_user", nil)
+	return c.GetUserInfoContext(context.Background())
+}
+
+// GetUserInfoContext is GetUserInfo with ctx attached to every request.
+func (c *Client) GetUserInfoContext(ctx context.Context) (*models.User, error) {
+	req, err := c.newRequest(ctx, "GET", "/get_current_user", nil)
 	if err != nil {
 		return nil, fmt.Errorf("creating request failed: %w", err)
 	}
@@ -62,8 +110,7 @@ func (c *Client) GetUserInfo() (*models.User, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+		return nil, apierror.FromResponse(apierror.Splitwise, resp)
 	}
 
 	var userResp getCurrentUserResponse
@@ -74,23 +121,144 @@ func (c *Client) GetUserInfo() (*models.User, error) {
 	return &userResp.User, nil
 }
 
-func (c *Client) GetAllExpenses(friendID int64, datedAfter string) ([]models.SplitwiseExpense, error) {
+func (c *Client) GetFriend(friendID int64) (*models.User, error) {
+	return c.GetFriendContext(context.Background(), friendID)
+}
+
+// GetFriendContext is GetFriend with ctx attached to every request. Splitwise
+// answers 404 when friendID is not one of the current user's friends.
+func (c *Client) GetFriendContext(ctx context.Context, friendID int64) (*models.User, error) {
+	if friendID <= 0 {
+		return nil, fmt.Errorf("invalid friend ID: %d", friendID)
+	}
+
+	req, err := c.newRequest(ctx, "GET", fmt.Sprintf("/get_friend/%d", friendID), nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request failed: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("performing request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apierror.FromResponse(apierror.Splitwise, resp)
+	}
+
+	var friendResp struct {
+		Friend models.User `json:"friend"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&friendResp); err != nil {
+		return nil, fmt.Errorf("decoding response failed: %w", err)
+	}
+
+	return &friendResp.Friend, nil
+}
+
+// expensesPageSize is the page size GetAllExpenses uses when the filter
+// doesn't set one. Splitwise's own default is 20.
+const expensesPageSize = 100
+
+// ExpenseFilter narrows down get_expenses. Zero values are left out of the
+// request.
+type ExpenseFilter struct {
+	FriendID      int64
+	GroupID       int64
+	DatedAfter    string
+	DatedBefore   string
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+	Limit         int
+	Offset        int
+}
+
+func (f ExpenseFilter) params() url.Values {
 	params := url.Values{}
 
-	if friendID > 0 {
-		params.Add("friend_id", fmt.Sprintf("%d", friendID))
+	if f.FriendID > 0 {
+		params.Add("friend_id", fmt.Sprintf("%d", f.FriendID))
+	}
+
+	if f.GroupID > 0 {
+		params.Add("group_id", fmt.Sprintf("%d", f.GroupID))
+	}
+
+	if f.DatedAfter != "" {
+		params.Add("dated_after", f.DatedAfter)
+	}
+
+	if f.DatedBefore != "" {
+		params.Add("dated_before", f.DatedBefore)
+	}
+
+	if !f.UpdatedAfter.IsZero() {
+		params.Add("updated_after", f.UpdatedAfter.UTC().Format(time.RFC3339))
+	}
+
+	if !f.UpdatedBefore.IsZero() {
+		params.Add("updated_before", f.UpdatedBefore.UTC().Format(time.RFC3339))
+	}
+
+	if f.Limit > 0 {
+		params.Add("limit", fmt.Sprintf("%d", f.Limit))
+	}
+
+	if f.Offset > 0 {
+		params.Add("offset", fmt.Sprintf("%d", f.Offset))
 	}
 
-	if datedAfter != "" {
-		params.Add("dated_after", datedAfter)
+	return params
+}
+
+// GetAllExpenses pages through every expense matching the filter, starting
+// at filter.Offset, filter.Limit expenses per request.
+func (c *Client) GetAllExpenses(filter ExpenseFilter) ([]models.SplitwiseExpense, error) {
+	return c.GetAllExpensesContext(context.Background(), filter)
+}
+
+// GetAllExpensesContext is GetAllExpenses with ctx attached to every request.
+func (c *Client) GetAllExpensesContext(ctx context.Context, filter ExpenseFilter) ([]models.SplitwiseExpense, error) {
+	if filter.Limit == 0 {
+		filter.Limit = expensesPageSize
+	}
+
+	var allExpenses []models.SplitwiseExpense
+	hasMore := true
+
+	for hasMore {
+		page, err := c.GetExpensesContext(ctx, filter)
+		if err != nil {
+			return nil, fmt.Errorf("fetching expenses at offset %d: %w", filter.Offset, err)
+		}
+
+		allExpenses = append(allExpenses, page...)
+		// Splitwise has no has_more flag; a short page is the last one
+		hasMore = len(page) == filter.Limit
+		filter.Offset += len(page)
+	}
+
+	return allExpenses, nil
+}
+
+// GetExpenses fetches one page of expenses matching the filter.
+func (c *Client) GetExpenses(filter ExpenseFilter) ([]models.SplitwiseExpense, error) {
+	return c.GetExpensesContext(context.Background(), filter)
+}
+
+// GetExpensesContext is GetExpenses with ctx attached to every request.
+func (c *Client) GetExpensesContext(ctx context.Context, filter ExpenseFilter) ([]models.SplitwiseExpense, error) {
+	if filter.Limit < 0 || filter.Offset < 0 {
+		return nil, fmt.Errorf("invalid limit %d or offset %d", filter.Limit, filter.Offset)
 	}
 
 	endpoint := "/get_expenses"
-	if len(params) > 0 {
+	if params := filter.params(); len(params) > 0 {
 		endpoint += "?" + params.Encode()
 	}
 
-	req, err := c.newRequest("GET", endpoint, nil)
+	req, err := c.newRequest(ctx, "GET", endpoint, nil)
 	if err != nil {
 		return nil, fmt.Errorf("creating request failed: %w", err)
 	}
@@ -102,8 +270,7 @@ func (c *Client) GetAllExpenses(friendID int64, datedAfter string) ([]models.Spl
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+		return nil, apierror.FromResponse(apierror.Splitwise, resp)
 	}
 
 	var expensesResp getExpensesResponse
@@ -115,13 +282,18 @@ func (c *Client) GetAllExpenses(friendID int64, datedAfter string) ([]models.Spl
 }
 
 func (c *Client) GetExpenseByID(expenseID int64) (models.SplitwiseExpense, error) {
+	return c.GetExpenseByIDContext(context.Background(), expenseID)
+}
+
+// GetExpenseByIDContext is GetExpenseByID with ctx attached to every request.
+func (c *Client) GetExpenseByIDContext(ctx context.Context, expenseID int64) (models.SplitwiseExpense, error) {
 	if expenseID <= 0 {
 		return models.SplitwiseExpense{}, fmt.Errorf("invalid expense ID: %d", expenseID)
 	}
 
 	endpoint := fmt.Sprintf("/get_expense?id=%d", expenseID)
 
-	req, err := c.newRequest("GET", endpoint, nil)
+	req, err := c.newRequest(ctx, "GET", endpoint, nil)
 	if err != nil {
 		return models.SplitwiseExpense{}, fmt.Errorf("creating request failed: %w", err)
 	}
@@ -133,8 +305,7 @@ func (c *Client) GetExpenseByID(expenseID int64) (models.SplitwiseExpense, error
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return models.SplitwiseExpense{}, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+		return models.SplitwiseExpense{}, apierror.FromResponse(apierror.Splitwise, resp)
 	}
 
 	var expenseResp struct {
@@ -147,13 +318,18 @@ func (c *Client) GetExpenseByID(expenseID int64) (models.SplitwiseExpense, error
 }
 
 func (c *Client) GetExpenseComments(expenseID int64) ([]models.SplitwiseComment, error) {
+	return c.GetExpenseCommentsContext(context.Background(), expenseID)
+}
+
+// GetExpenseCommentsContext is GetExpenseComments with ctx attached to every request.
+func (c *Client) GetExpenseCommentsContext(ctx context.Context, expenseID int64) ([]models.SplitwiseComment, error) {
 	if expenseID <= 0 {
 		return nil, fmt.Errorf("invalid expense ID: %d", expenseID)
 	}
 
 	endpoint := fmt.Sprintf("/get_comments?expense_id=%d", expenseID)
 
-	req, err := c.newRequest("GET", endpoint, nil)
+	req, err := c.newRequest(ctx, "GET", endpoint, nil)
 	if err != nil {
 		return nil, fmt.Errorf("creating request failed: %w", err)
 	}
@@ -165,8 +341,7 @@ func (c *Client) GetExpenseComments(expenseID int64) ([]models.SplitwiseComment,
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+		return nil, apierror.FromResponse(apierror.Splitwise, resp)
 	}
 
 	var commentsResp struct {
@@ -180,6 +355,11 @@ func (c *Client) GetExpenseComments(expenseID int64) ([]models.SplitwiseComment,
 }
 
 func (c *Client) AddCommentToExpense(expenseID int64, comment string) error {
+	return c.AddCommentToExpenseContext(context.Background(), expenseID, comment)
+}
+
+// AddCommentToExpenseContext is AddCommentToExpense with ctx attached to every request.
+func (c *Client) AddCommentToExpenseContext(ctx context.Context, expenseID int64, comment string) error {
 	if expenseID <= 0 {
 		return fmt.Errorf("invalid expense ID: %d", expenseID)
 	}
@@ -188,10 +368,17 @@ func (c *Client) AddCommentToExpense(expenseID int64, comment string) error {
 		return fmt.Errorf("comment cannot be empty")
 	}
 
-	endpoint := fmt.Sprintf("/create_comment?expense_id=%d&content=%s", expenseID, url.PathEscape(comment))
-	fmt.Println(endpoint)
+	// in the body, sync comments carry JSON that no query string escaping
+	// would keep intact
+	body, err := json.Marshal(struct {
+		ExpenseID int64  `json:"expense_id"`
+		Content   string `json:"content"`
+	}{ExpenseID: expenseID, Content: comment})
+	if err != nil {
+		return fmt.Errorf("encoding comment failed: %w", err)
+	}
 
-	req, err := c.newRequest("POST", endpoint, nil)
+	req, err := c.newRequest(ctx, "POST", "/create_comment", bytes.NewReader(body))
 	if err != nil {
 		return fmt.Errorf("creating request failed: %w", err)
 	}
@@ -203,21 +390,25 @@ func (c *Client) AddCommentToExpense(expenseID int64, comment string) error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+		return apierror.FromResponse(apierror.Splitwise, resp)
 	}
 
 	return nil
 }
 
 func (c *Client) DeleteComment(commentID int64) error {
+	return c.DeleteCommentContext(context.Background(), commentID)
+}
+
+// DeleteCommentContext is DeleteComment with ctx attached to every request.
+func (c *Client) DeleteCommentContext(ctx context.Context, commentID int64) error {
 	if commentID <= 0 {
 		return fmt.Errorf("invalid comment ID: %d", commentID)
 	}
 
 	endpoint := fmt.Sprintf("/delete_comment/%d", commentID)
 
-	req, err := c.newRequest("POST", endpoint, nil)
+	req, err := c.newRequest(ctx, "POST", endpoint, nil)
 	if err != nil {
 		return fmt.Errorf("creating request failed: %w", err)
 	}
@@ -229,8 +420,7 @@ func (c *Client) DeleteComment(commentID int64) error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+		return apierror.FromResponse(apierror.Splitwise, resp)
 	}
 
 	return nil
@@ -1,9 +1,17 @@
 package splitwise
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
+
+	"github.com/jasmineyas/splitwise-lunchmoney/apierror"
+	"github.com/jasmineyas/splitwise-lunchmoney/ratelimit"
 )
 
 func TestGetUserInfo(t *testing.T) {
@@ -91,6 +99,7 @@ func TestGetUserInfo(t *testing.T) {
 			// Create client pointing to mock server
 			client := NewClient("test-token")
 			client.baseURL = server.URL
+			client.httpClient = &http.Client{}
 
 			// Call the function
 			user, err := client.GetUserInfo()
@@ -119,6 +128,154 @@ func TestGetUserInfo(t *testing.T) {
 	}
 }
 
+func TestGetFriend(t *testing.T) {
+	tests := []struct {
+		name         string
+		statusCode   int
+		responseBody string
+		wantFirst    string
+		wantNotFound bool
+		expectError  bool
+	}{
+		{
+			name:         "friend",
+			statusCode:   200,
+			responseBody: `{"friend": {"id": 50086667, "first_name": "Wesley", "last_name": "Finck"}}`,
+			wantFirst:    "Wesley",
+		},
+		{
+			name:         "not a friend",
+			statusCode:   404,
+			responseBody: `{"errors": {"base": ["Not found"]}}`,
+			wantNotFound: true,
+			expectError:  true,
+		},
+		{
+			name:         "unauthorized",
+			statusCode:   401,
+			responseBody: `{"error": "Invalid token"}`,
+			expectError:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/get_friend/50086667" {
+					t.Errorf("Expected path /get_friend/50086667, got %s", r.URL.Path)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.statusCode)
+				w.Write([]byte(tt.responseBody))
+			}))
+			defer server.Close()
+
+			client := NewClient("test-token")
+			client.baseURL = server.URL
+			client.httpClient = &http.Client{}
+
+			friend, err := client.GetFriend(50086667)
+
+			if tt.expectError && err == nil {
+				t.Fatal("Expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if apierror.IsNotFound(err) != tt.wantNotFound {
+				t.Errorf("IsNotFound(%v) = %v, want %v", err, !tt.wantNotFound, tt.wantNotFound)
+			}
+			if !tt.expectError && (friend.ID != 50086667 || friend.FirstName != tt.wantFirst) {
+				t.Errorf("GetFriend() = %+v, want Wesley (50086667)", friend)
+			}
+		})
+	}
+}
+
+func TestGetUserInfoRetries(t *testing.T) {
+	// the other tests swap in a plain http.Client so each case sees exactly
+	// one response; this one keeps NewClient's retrying transport
+	requestCount := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+		if requestCount < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"user": {"id": 9792490, "first_name": "Jasmine"}}`))
+	}))
+	defer server.Close()
+
+	client := NewClient("test-token")
+	client.baseURL = server.URL
+
+	user, err := client.GetUserInfo()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if user.ID != 9792490 {
+		t.Errorf("Expected user ID 9792490, got %d", user.ID)
+	}
+	if requestCount != 3 {
+		t.Errorf("Expected 3 requests, got %d", requestCount)
+	}
+}
+
+func TestGetAllExpensesContextCancelled(t *testing.T) {
+	// with the retrying transport, a 503 would normally be retried after a
+	// backoff; the deadline has to cut that wait short
+	requestCount := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := NewClient("test-token")
+	client.baseURL = server.URL
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.GetAllExpensesContext(ctx, ExpenseFilter{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the call to stop at the deadline, took %v", elapsed)
+	}
+	if requestCount != 1 {
+		t.Errorf("Expected 1 request, got %d", requestCount)
+	}
+}
+
+func TestRateLimitOption(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"user": {"id": 9792490}}`))
+	}))
+	defer server.Close()
+
+	limiter := ratelimit.New(1000, 10)
+	first := NewClient("test-token", WithLimiter(limiter))
+	first.baseURL = server.URL
+	second := NewClient("test-token", WithLimiter(limiter))
+	second.baseURL = server.URL
+
+	for _, client := range []*Client{first, second, first} {
+		if _, err := client.GetUserInfo(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if stats := first.RateLimitStats(); stats.Requests != 3 {
+		t.Errorf("Expected 3 requests through the shared limiter, got %d", stats.Requests)
+	}
+}
+
 func TestGetAllExpenses(t *testing.T) {
 	tests := []struct {
 		name            string
@@ -135,7 +292,7 @@ func TestGetAllExpenses(t *testing.T) {
 			name:         "success with expenses - no filters",
 			friendID:     0,
 			datedAfter:   "",
-			expectedPath: "/get_expenses",
+			expectedPath: "/get_expenses?limit=100",
 			statusCode:   200,
 			responseBody: `{
 				"expenses": [
@@ -191,7 +348,7 @@ func TestGetAllExpenses(t *testing.T) {
 			name:         "success with friend filter",
 			friendID:     50086667,
 			datedAfter:   "",
-			expectedPath: "/get_expenses?friend_id=50086667",
+			expectedPath: "/get_expenses?friend_id=50086667&limit=100",
 			statusCode:   200,
 			responseBody: `{
 				"expenses": [
@@ -216,7 +373,7 @@ func TestGetAllExpenses(t *testing.T) {
 			name:          "success with empty expenses",
 			friendID:      0,
 			datedAfter:    "",
-			expectedPath:  "/get_expenses",
+			expectedPath:  "/get_expenses?limit=100",
 			statusCode:    200,
 			responseBody:  `{"expenses": []}`,
 			expectedCount: 0,
@@ -226,7 +383,7 @@ func TestGetAllExpenses(t *testing.T) {
 			name:         "success with dated_after filter",
 			friendID:     0,
 			datedAfter:   "2025-12-01T00:00:00Z",
-			expectedPath: "/get_expenses?dated_after=2025-12-01T00%3A00%3A00Z",
+			expectedPath: "/get_expenses?dated_after=2025-12-01T00%3A00%3A00Z&limit=100",
 			statusCode:   200,
 			responseBody: `{
 				"expenses": [
@@ -251,7 +408,7 @@ func TestGetAllExpenses(t *testing.T) {
 			name:         "success with both friend and dated_after filters",
 			friendID:     50086667,
 			datedAfter:   "2025-12-01T00:00:00Z",
-			expectedPath: "/get_expenses?dated_after=2025-12-01T00%3A00%3A00Z&friend_id=50086667",
+			expectedPath: "/get_expenses?dated_after=2025-12-01T00%3A00%3A00Z&friend_id=50086667&limit=100",
 			statusCode:   200,
 			responseBody: `{
 				"expenses": [
@@ -276,7 +433,7 @@ func TestGetAllExpenses(t *testing.T) {
 			name:         "unauthorized",
 			friendID:     0,
 			datedAfter:   "",
-			expectedPath: "/get_expenses",
+			expectedPath: "/get_expenses?limit=100",
 			statusCode:   401,
 			responseBody: `{"error": "Invalid token"}`,
 			expectError:  true,
@@ -285,7 +442,7 @@ func TestGetAllExpenses(t *testing.T) {
 			name:         "server error",
 			friendID:     0,
 			datedAfter:   "",
-			expectedPath: "/get_expenses",
+			expectedPath: "/get_expenses?limit=100",
 			statusCode:   500,
 			responseBody: `{"error": "Internal server error"}`,
 			expectError:  true,
@@ -294,7 +451,7 @@ func TestGetAllExpenses(t *testing.T) {
 			name:         "invalid json",
 			friendID:     0,
 			datedAfter:   "",
-			expectedPath: "/get_expenses",
+			expectedPath: "/get_expenses?limit=100",
 			statusCode:   200,
 			responseBody: `{invalid json}`,
 			expectError:  true,
@@ -330,9 +487,10 @@ func TestGetAllExpenses(t *testing.T) {
 			// Create client pointing to mock server
 			client := NewClient("test-token")
 			client.baseURL = server.URL
+			client.httpClient = &http.Client{}
 
 			// Call the function
-			expenses, err := client.GetAllExpenses(tt.friendID, tt.datedAfter)
+			expenses, err := client.GetAllExpenses(ExpenseFilter{FriendID: tt.friendID, DatedAfter: tt.datedAfter})
 
 			// Check error expectation
 			if tt.expectError && err == nil {
@@ -355,6 +513,208 @@ func TestGetAllExpenses(t *testing.T) {
 	}
 }
 
+func TestGetAllExpensesPagination(t *testing.T) {
+	tests := []struct {
+		name            string
+		filter          ExpenseFilter
+		pages           []string
+		statuses        []int
+		expectedOffsets []string
+		expectedCount   int
+		expectError     bool
+	}{
+		{
+			name:   "three pages",
+			filter: ExpenseFilter{FriendID: 50086667, Limit: 2},
+			pages: []string{
+				`{"expenses": [{"id": 1}, {"id": 2}]}`,
+				`{"expenses": [{"id": 3}, {"id": 4}]}`,
+				`{"expenses": [{"id": 5}]}`,
+			},
+			statuses:        []int{200, 200, 200},
+			expectedOffsets: []string{"", "2", "4"},
+			expectedCount:   5,
+		},
+		{
+			name:   "last page exactly full needs one more request",
+			filter: ExpenseFilter{Limit: 2},
+			pages: []string{
+				`{"expenses": [{"id": 1}, {"id": 2}]}`,
+				`{"expenses": []}`,
+			},
+			statuses:        []int{200, 200},
+			expectedOffsets: []string{"", "2"},
+			expectedCount:   2,
+		},
+		{
+			name:   "default page size",
+			filter: ExpenseFilter{},
+			pages: []string{
+				`{"expenses": [{"id": 1}]}`,
+			},
+			statuses:        []int{200},
+			expectedOffsets: []string{""},
+			expectedCount:   1,
+		},
+		{
+			name:   "error on second page",
+			filter: ExpenseFilter{Limit: 1, DatedBefore: "2025-12-31", GroupID: 61230544},
+			pages: []string{
+				`{"expenses": [{"id": 1}]}`,
+				`{"error": "Internal server error"}`,
+			},
+			statuses:        []int{200, 500},
+			expectedOffsets: []string{"", "1"},
+			expectError:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requestCount := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if requestCount >= len(tt.pages) {
+					t.Fatalf("unexpected request %d: %s", requestCount, r.URL.RawQuery)
+				}
+
+				query := r.URL.Query()
+				if query.Get("offset") != tt.expectedOffsets[requestCount] {
+					t.Errorf("request %d: expected offset %q, got %q", requestCount, tt.expectedOffsets[requestCount], query.Get("offset"))
+				}
+				expectedLimit := tt.filter.Limit
+				if expectedLimit == 0 {
+					expectedLimit = expensesPageSize
+				}
+				if query.Get("limit") != strconv.Itoa(expectedLimit) {
+					t.Errorf("request %d: expected limit %d, got %q", requestCount, expectedLimit, query.Get("limit"))
+				}
+				if tt.filter.DatedBefore != "" && query.Get("dated_before") != tt.filter.DatedBefore {
+					t.Errorf("expected dated_before %s, got %s", tt.filter.DatedBefore, query.Get("dated_before"))
+				}
+				if tt.filter.GroupID > 0 && query.Get("group_id") != strconv.FormatInt(tt.filter.GroupID, 10) {
+					t.Errorf("expected group_id %d, got %s", tt.filter.GroupID, query.Get("group_id"))
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.statuses[requestCount])
+				w.Write([]byte(tt.pages[requestCount]))
+				requestCount++
+			}))
+			defer server.Close()
+
+			client := NewClient("test-token")
+			client.baseURL = server.URL
+			client.httpClient = &http.Client{}
+
+			expenses, err := client.GetAllExpenses(tt.filter)
+
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if len(expenses) != tt.expectedCount {
+				t.Errorf("Expected %d expenses, got %d", tt.expectedCount, len(expenses))
+			}
+			if requestCount != len(tt.pages) {
+				t.Errorf("Expected %d requests, got %d", len(tt.pages), requestCount)
+			}
+			for i, expense := range expenses {
+				if expense.ID != int64(i+1) {
+					t.Errorf("Expected expense %d to have ID %d, got %d", i, i+1, expense.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestGetExpenses(t *testing.T) {
+	tests := []struct {
+		name         string
+		filter       ExpenseFilter
+		expectedPath string
+		expectError  bool
+	}{
+		{
+			name:         "no filters",
+			filter:       ExpenseFilter{},
+			expectedPath: "/get_expenses",
+		},
+		{
+			name: "updated after with paging",
+			filter: ExpenseFilter{
+				FriendID:     50086667,
+				UpdatedAfter: time.Date(2025, 12, 1, 8, 30, 0, 0, time.FixedZone("PST", -8*60*60)),
+				Limit:        100,
+				Offset:       200,
+			},
+			expectedPath: "/get_expenses?friend_id=50086667&limit=100&offset=200&updated_after=2025-12-01T16%3A30%3A00Z",
+		},
+		{
+			name: "date and group bounds",
+			filter: ExpenseFilter{
+				GroupID:       61230544,
+				DatedBefore:   "2025-12-31",
+				UpdatedBefore: time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC),
+			},
+			expectedPath: "/get_expenses?dated_before=2025-12-31&group_id=61230544&updated_before=2025-12-31T00%3A00%3A00Z",
+		},
+		{
+			name:        "negative limit",
+			filter:      ExpenseFilter{Limit: -1},
+			expectError: true,
+		},
+		{
+			name:        "negative offset",
+			filter:      ExpenseFilter{Offset: -1},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fullPath := r.URL.Path
+				if r.URL.RawQuery != "" {
+					fullPath += "?" + r.URL.RawQuery
+				}
+				if fullPath != tt.expectedPath {
+					t.Errorf("Expected path %s, got %s", tt.expectedPath, fullPath)
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(`{"expenses": [{"id": 4198563142}]}`))
+			}))
+			defer server.Close()
+
+			client := NewClient("test-token")
+			client.baseURL = server.URL
+			client.httpClient = &http.Client{}
+
+			expenses, err := client.GetExpenses(tt.filter)
+
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(expenses) != 1 {
+				t.Errorf("Expected 1 expense, got %d", len(expenses))
+			}
+		})
+	}
+}
+
 func TestGetExpense(t *testing.T) {
 	tests := []struct {
 		name              string
@@ -482,6 +842,7 @@ func TestGetExpense(t *testing.T) {
 			// Create client pointing to mock server
 			client := NewClient("test-token")
 			client.baseURL = server.URL
+			client.httpClient = &http.Client{}
 
 			// Call the function
 			expense, err := client.GetExpenseByID(tt.expenseID)
@@ -633,6 +994,7 @@ func TestGetExpenseComments(t *testing.T) {
 			// Create client pointing to mock server
 			client := NewClient("test-token")
 			client.baseURL = server.URL
+			client.httpClient = &http.Client{}
 
 			// Call the function
 			comments, err := client.GetExpenseComments(tt.expenseID)
@@ -660,7 +1022,6 @@ func TestAddCommentToExpense(t *testing.T) {
 		name         string
 		expenseID    int64
 		comment      string
-		expectedPath string
 		statusCode   int
 		responseBody string
 		expectError  bool
@@ -669,7 +1030,6 @@ func TestAddCommentToExpense(t *testing.T) {
 			name:         "success",
 			expenseID:    4198563142,
 			comment:      "synced-to-LM",
-			expectedPath: "/create_comment?expense_id=4198563142&content=synced-to-LM",
 			statusCode:   200,
 			responseBody: `{"success": true}`,
 			expectError:  false,
@@ -678,7 +1038,15 @@ func TestAddCommentToExpense(t *testing.T) {
 			name:         "success with special characters",
 			expenseID:    4198563142,
 			comment:      "LM ID: 12345",
-			expectedPath: "/create_comment?expense_id=4198563142&content=LM%20ID:%2012345",
+			statusCode:   200,
+			responseBody: `{"success": true}`,
+			expectError:  false,
+		},
+		{
+			// query string escaping used to cut the comment off at the &
+			name:         "sync comment with reserved characters",
+			expenseID:    4198563142,
+			comment:      "Synced-to-LM v1\n{\"notes\":\"Food & drinks + tip #2 = 100%\"}",
 			statusCode:   200,
 			responseBody: `{"success": true}`,
 			expectError:  false,
@@ -705,7 +1073,6 @@ func TestAddCommentToExpense(t *testing.T) {
 			name:         "expense not found",
 			expenseID:    999999999,
 			comment:      "test",
-			expectedPath: "/create_comment?expense_id=999999999&content=test",
 			statusCode:   404,
 			responseBody: `{"error": "Expense not found"}`,
 			expectError:  true,
@@ -714,7 +1081,6 @@ func TestAddCommentToExpense(t *testing.T) {
 			name:         "unauthorized",
 			expenseID:    123456,
 			comment:      "test",
-			expectedPath: "/create_comment?expense_id=123456&content=test",
 			statusCode:   401,
 			responseBody: `{"error": "Invalid token"}`,
 			expectError:  true,
@@ -740,13 +1106,23 @@ func TestAddCommentToExpense(t *testing.T) {
 					t.Errorf("Expected POST method, got %s", r.Method)
 				}
 
-				// Verify request path (including query parameters)
-				fullPath := r.URL.Path
-				if r.URL.RawQuery != "" {
-					fullPath += "?" + r.URL.RawQuery
+				if r.URL.Path != "/create_comment" || r.URL.RawQuery != "" {
+					t.Errorf("Expected path /create_comment, got %s", r.URL.String())
 				}
-				if fullPath != tt.expectedPath {
-					t.Errorf("Expected path %s, got %s", tt.expectedPath, fullPath)
+
+				// Verify the comment arrives exactly as sent
+				var body struct {
+					ExpenseID int64  `json:"expense_id"`
+					Content   string `json:"content"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Errorf("decoding request body: %v", err)
+				}
+				if body.ExpenseID != tt.expenseID {
+					t.Errorf("Expected expense_id %d, got %d", tt.expenseID, body.ExpenseID)
+				}
+				if body.Content != tt.comment {
+					t.Errorf("Expected content %q, got %q", tt.comment, body.Content)
 				}
 
 				// Verify authorization header
@@ -765,6 +1141,7 @@ func TestAddCommentToExpense(t *testing.T) {
 			// Create client pointing to mock server
 			client := NewClient("test-token")
 			client.baseURL = server.URL
+			client.httpClient = &http.Client{}
 
 			// Call the function
 			err := client.AddCommentToExpense(tt.expenseID, tt.comment)
@@ -873,6 +1250,7 @@ func TestDeleteComment(t *testing.T) {
 			// Create client pointing to mock server
 			client := NewClient("test-token")
 			client.baseURL = server.URL
+			client.httpClient = &http.Client{}
 
 			// Call the function
 			err := client.DeleteComment(tt.commentID)
@@ -887,3 +1265,136 @@ func TestDeleteComment(t *testing.T) {
 		})
 	}
 }
+
+func TestGetExpensePayments(t *testing.T) {
+	receiptURL := "https://s3.amazonaws.com/splitwise/uploads/expense/receipt/original/receipt.jpg"
+
+	// Splitwise records a payment as an expense the sender paid in full and
+	// the receiver owes, so the repayment runs from the receiver (negative
+	// net balance) to the sender, opposite to the money.
+	tests := []struct {
+		name            string
+		responseBody    string
+		expectedFrom    int64
+		expectedTo      int64
+		expectedAmount  string
+		expectedGroupID *int64
+		expectedReceipt *string
+	}{
+		{
+			name: "friend pays me back",
+			responseBody: `{
+				"expense": {
+					"id": 4109650330,
+					"group_id": null,
+					"description": "Payment",
+					"payment": true,
+					"creation_method": "payment",
+					"cost": "50.0",
+					"currency_code": "CAD",
+					"date": "2025-10-11T06:58:32Z",
+					"updated_at": "2025-10-11T07:00:00Z",
+					"category": {"id": 18, "name": "General"},
+					"receipt": {"large": null, "original": null},
+					"deleted_at": null,
+					"deleted_by": null,
+					"repayments": [
+						{"from": 9792490, "to": 50086667, "amount": "50.0"}
+					],
+					"users": [
+						{"user": {"id": 50086667, "first_name": "Wesley", "last_name": "Finck"}, "user_id": 50086667, "paid_share": "50.0", "owed_share": "0.0", "net_balance": "50.0"},
+						{"user": {"id": 9792490, "first_name": "Jasmine", "last_name": "Zou"}, "user_id": 9792490, "paid_share": "0.0", "owed_share": "50.0", "net_balance": "-50.0"}
+					]
+				}
+			}`,
+			expectedFrom:   9792490,
+			expectedTo:     50086667,
+			expectedAmount: "50.0",
+		},
+		{
+			name: "I pay friend back in a group",
+			responseBody: `{
+				"expense": {
+					"id": 4109650331,
+					"group_id": 61230544,
+					"description": "Payment",
+					"payment": true,
+					"creation_method": "payment",
+					"cost": "17.86",
+					"currency_code": "CAD",
+					"date": "2025-10-12T06:58:32Z",
+					"updated_at": "2025-10-12T07:00:00Z",
+					"category": {"id": 18, "name": "General"},
+					"receipt": {"large": null, "original": "` + receiptURL + `"},
+					"deleted_at": null,
+					"deleted_by": null,
+					"repayments": [
+						{"from": 50086667, "to": 9792490, "amount": "17.86"}
+					],
+					"users": [
+						{"user": {"id": 9792490, "first_name": "Jasmine", "last_name": "Zou"}, "user_id": 9792490, "paid_share": "17.86", "owed_share": "0.0", "net_balance": "17.86"},
+						{"user": {"id": 50086667, "first_name": "Wesley", "last_name": "Finck"}, "user_id": 50086667, "paid_share": "0.0", "owed_share": "17.86", "net_balance": "-17.86"}
+					]
+				}
+			}`,
+			expectedFrom:    50086667,
+			expectedTo:      9792490,
+			expectedAmount:  "17.86",
+			expectedGroupID: func() *int64 { id := int64(61230544); return &id }(),
+			expectedReceipt: &receiptURL,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(tt.responseBody))
+			}))
+			defer server.Close()
+
+			client := NewClient("test-token")
+			client.baseURL = server.URL
+			client.httpClient = &http.Client{}
+
+			expense, err := client.GetExpenseByID(4109650330)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !expense.Payment {
+				t.Error("Expected payment to be true")
+			}
+			if expense.CreationMethod != "payment" {
+				t.Errorf("Expected creation method 'payment', got '%s'", expense.CreationMethod)
+			}
+			if expense.Category.Name != "General" {
+				t.Errorf("Expected category 'General', got '%s'", expense.Category.Name)
+			}
+			if expense.UpdatedAt.IsZero() {
+				t.Error("Expected updated_at to be decoded")
+			}
+
+			if (expense.GroupID == nil) != (tt.expectedGroupID == nil) ||
+				(expense.GroupID != nil && *expense.GroupID != *tt.expectedGroupID) {
+				t.Errorf("Expected group ID %v, got %v", tt.expectedGroupID, expense.GroupID)
+			}
+			if (expense.Receipt.Original == nil) != (tt.expectedReceipt == nil) ||
+				(expense.Receipt.Original != nil && *expense.Receipt.Original != *tt.expectedReceipt) {
+				t.Errorf("Expected receipt %v, got %v", tt.expectedReceipt, expense.Receipt.Original)
+			}
+
+			if len(expense.Repayments) != 1 {
+				t.Fatalf("Expected 1 repayment, got %d", len(expense.Repayments))
+			}
+			repayment := expense.Repayments[0]
+			if repayment.From != tt.expectedFrom || repayment.To != tt.expectedTo {
+				t.Errorf("Expected repayment %d -> %d, got %d -> %d", tt.expectedFrom, tt.expectedTo, repayment.From, repayment.To)
+			}
+			if repayment.Amount != tt.expectedAmount {
+				t.Errorf("Expected amount %s, got %s", tt.expectedAmount, repayment.Amount)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+// Concurrent comment fetching for many expenses
+
+package splitwise
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jasmineyas/splitwise-lunchmoney/apierror"
+	"github.com/jasmineyas/splitwise-lunchmoney/models"
+)
+
+// DefaultCommentWorkers is how many comment requests GetCommentsForExpenses
+// keeps in flight. The rate limiter is shared by all of them, so more
+// workers only help while requests are waiting on the network.
+const DefaultCommentWorkers = 4
+
+func (c *Client) GetCommentsForExpenses(expenseIDs []int64, workers int) (map[int64][]models.SplitwiseComment, error) {
+	return c.GetCommentsForExpensesContext(context.Background(), expenseIDs, workers)
+}
+
+// GetCommentsForExpensesContext fetches the comments of every expense using
+// up to workers concurrent requests (DefaultCommentWorkers if workers <= 0).
+// One expense failing doesn't stop the others: the result holds every
+// expense that succeeded and the error is an *apierror.PartialError naming the
+// rest. A rejected token or a cancelled ctx stops the remaining fetches,
+// which are reported as failed too.
+func (c *Client) GetCommentsForExpensesContext(ctx context.Context, expenseIDs []int64, workers int) (map[int64][]models.SplitwiseComment, error) {
+	if workers <= 0 {
+		workers = DefaultCommentWorkers
+	}
+
+	ctx, stop := context.WithCancelCause(ctx)
+	defer stop(nil)
+
+	var mu sync.Mutex
+	comments := make(map[int64][]models.SplitwiseComment, len(expenseIDs))
+	failed := make(map[int64]error)
+
+	ids := make(chan int64)
+	var wg sync.WaitGroup
+	for range min(workers, len(expenseIDs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range ids {
+				if ctx.Err() != nil {
+					mu.Lock()
+					failed[id] = context.Cause(ctx)
+					mu.Unlock()
+					continue
+				}
+
+				expenseComments, err := c.GetExpenseCommentsContext(ctx, id)
+				if apierror.IsUnauthorized(err) {
+					// every other request would be refused too
+					stop(err)
+				}
+
+				mu.Lock()
+				if err != nil {
+					failed[id] = err
+				} else {
+					comments[id] = expenseComments
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, id := range expenseIDs {
+		ids <- id
+	}
+	close(ids)
+	wg.Wait()
+
+	if len(failed) > 0 {
+		return comments, &apierror.PartialError{Op: "fetching comments", Failed: failed, Total: len(expenseIDs)}
+	}
+	return comments, nil
+}
@@ -0,0 +1,135 @@
+package splitwise
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jasmineyas/splitwise-lunchmoney/apierror"
+)
+
+func TestGetCommentsForExpenses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("expense_id") {
+		case "2":
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error": "boom"}`))
+		default:
+			w.Write([]byte(`{"comments": [{"id": ` + r.URL.Query().Get("expense_id") + `, "content": "hi"}]}`))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient("test-token")
+	client.baseURL = server.URL
+	client.httpClient = &http.Client{}
+
+	comments, err := client.GetCommentsForExpenses([]int64{1, 2, 3}, 2)
+
+	var fetchErr *apierror.PartialError
+	if !errors.As(err, &fetchErr) {
+		t.Fatalf("Expected *apierror.PartialError, got %v", err)
+	}
+	if len(fetchErr.Failed) != 1 || fetchErr.Failed[2] == nil {
+		t.Errorf("Expected only expense 2 to fail, got %v", fetchErr.Failed)
+	}
+	var apiErr *apierror.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected the expense's API error to be reachable, got %v", err)
+	}
+
+	if len(comments) != 2 {
+		t.Fatalf("Expected comments for 2 expenses, got %d", len(comments))
+	}
+	for _, id := range []int64{1, 3} {
+		if len(comments[id]) != 1 || comments[id][0].ID != id {
+			t.Errorf("Expected comment %d for expense %d, got %v", id, id, comments[id])
+		}
+	}
+}
+
+func TestGetCommentsForExpensesWorkers(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		w.Write([]byte(`{"comments": []}`))
+	}))
+	defer server.Close()
+
+	client := NewClient("test-token")
+	client.baseURL = server.URL
+	client.httpClient = &http.Client{}
+
+	ids := make([]int64, 20)
+	for i := range ids {
+		ids[i] = int64(i + 1)
+	}
+
+	comments, err := client.GetCommentsForExpenses(ids, 3)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(comments) != len(ids) {
+		t.Errorf("Expected comments for %d expenses, got %d", len(ids), len(comments))
+	}
+	if maxInFlight > 3 {
+		t.Errorf("Expected at most 3 requests in flight, got %d", maxInFlight)
+	}
+	if maxInFlight < 2 {
+		t.Errorf("Expected requests to run concurrently, got at most %d in flight", maxInFlight)
+	}
+}
+
+func TestGetCommentsForExpensesUnauthorized(t *testing.T) {
+	var mu sync.Mutex
+	requestCount := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requestCount++
+		mu.Unlock()
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error": "Invalid API request: you are not logged in"}`))
+	}))
+	defer server.Close()
+
+	client := NewClient("test-token")
+	client.baseURL = server.URL
+	client.httpClient = &http.Client{}
+
+	ids := make([]int64, 50)
+	for i := range ids {
+		ids[i] = int64(i + 1)
+	}
+
+	_, err := client.GetCommentsForExpenses(ids, 1)
+
+	if !apierror.IsUnauthorized(err) {
+		t.Errorf("Expected an unauthorized error, got %v", err)
+	}
+	var fetchErr *apierror.PartialError
+	if !errors.As(err, &fetchErr) || len(fetchErr.Failed) != len(ids) {
+		t.Errorf("Expected all %d expenses reported as failed, got %v", len(ids), err)
+	}
+	if requestCount != 1 {
+		t.Errorf("Expected fetching to stop after the first 401, got %d requests", requestCount)
+	}
+	if want := "fetching comments failed for 50 of 50 expenses"; err == nil || !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("Expected error to start with %q, got %v", want, err)
+	}
+}
@@ -0,0 +1,121 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/jasmineyas/splitwise-lunchmoney/apierror"
+	"github.com/jasmineyas/splitwise-lunchmoney/detector"
+	"github.com/jasmineyas/splitwise-lunchmoney/models"
+)
+
+// CommentAPI is the part of the Splitwise client CommentStore uses.
+type CommentAPI interface {
+	GetUserInfoContext(ctx context.Context) (*models.User, error)
+	GetCommentsForExpensesContext(ctx context.Context, expenseIDs []int64, workers int) (map[int64][]models.SplitwiseComment, error)
+	AddCommentToExpenseContext(ctx context.Context, expenseID int64, comment string) error
+}
+
+// CommentStore keeps state in comments on the Splitwise expenses themselves,
+// as "Synced-to-LM v1" and "Deleted-from-LM v1" comments or whatever markers
+// the detector options name. Only comments by the sync user are trusted.
+type CommentStore struct {
+	client  CommentAPI
+	workers int
+
+	mu   sync.Mutex // guards opts while the sync user is resolved
+	opts detector.Options
+}
+
+// NewCommentStore reads comments with up to workers concurrent requests. When
+// opts.SyncUserID is zero the authenticated Splitwise user is looked up on
+// first use.
+func NewCommentStore(client CommentAPI, workers int, opts detector.Options) *CommentStore {
+	return &CommentStore{client: client, workers: workers, opts: opts}
+}
+
+func (s *CommentStore) Load(ctx context.Context, expenseIDs []int64) (map[int64]models.ExpenseState, error) {
+	opts, err := s.options(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	comments, err := s.client.GetCommentsForExpensesContext(ctx, expenseIDs, s.workers)
+	loadErr := &apierror.PartialError{Op: "loading sync state", Failed: make(map[int64]error), Total: len(expenseIDs)}
+	var fetchErr *apierror.PartialError
+	switch {
+	case errors.As(err, &fetchErr):
+		for id, err := range fetchErr.Failed {
+			loadErr.Failed[id] = err
+		}
+	case err != nil:
+		return nil, err
+	}
+
+	states := make(map[int64]models.ExpenseState, len(comments))
+	for id, expenseComments := range comments {
+		expenseState, err := detector.StateFromComments(expenseComments, opts)
+		if err != nil {
+			loadErr.Failed[id] = err
+			continue
+		}
+		if expenseState != (models.ExpenseState{}) {
+			states[id] = expenseState
+		}
+	}
+
+	if len(loadErr.Failed) > 0 {
+		return states, loadErr
+	}
+	return states, nil
+}
+
+func (s *CommentStore) SaveSync(ctx context.Context, metadata models.SyncMetadata) error {
+	content, err := s.currentOptions().EncodeSyncComment(metadata)
+	if err != nil {
+		return err
+	}
+	if err := s.client.AddCommentToExpenseContext(ctx, metadata.SplitwiseExpenseID, content); err != nil {
+		return fmt.Errorf("posting sync comment failed: %w", err)
+	}
+	return nil
+}
+
+func (s *CommentStore) SaveDeletion(ctx context.Context, metadata models.DeletionMetadata) error {
+	content, err := s.currentOptions().EncodeDeletionComment(metadata)
+	if err != nil {
+		return err
+	}
+	if err := s.client.AddCommentToExpenseContext(ctx, metadata.SplitwiseExpenseID, content); err != nil {
+		return fmt.Errorf("posting deletion comment failed: %w", err)
+	}
+	return nil
+}
+
+// options resolves the sync user on first use. The lock is held across the
+// lookup so concurrent callers wait for it rather than racing to set it; a
+// failed lookup is retried by the next caller.
+func (s *CommentStore) options(ctx context.Context) (detector.Options, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.opts.SyncUserID != 0 {
+		return s.opts, nil
+	}
+
+	user, err := s.client.GetUserInfoContext(ctx)
+	if err != nil {
+		return detector.Options{}, fmt.Errorf("looking up the sync user: %w", err)
+	}
+	s.opts.SyncUserID = user.ID
+	return s.opts, nil
+}
+
+// currentOptions is enough for encoding, which doesn't need the sync user.
+func (s *CommentStore) currentOptions() detector.Options {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.opts
+}
@@ -0,0 +1,53 @@
+package state
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jasmineyas/splitwise-lunchmoney/detector"
+	"github.com/jasmineyas/splitwise-lunchmoney/models"
+)
+
+// commentAPI serves no comments and counts user lookups.
+type commentAPI struct {
+	lookups atomic.Int32
+}
+
+func (c *commentAPI) GetUserInfoContext(ctx context.Context) (*models.User, error) {
+	c.lookups.Add(1)
+	return &models.User{ID: 42}, nil
+}
+
+func (c *commentAPI) GetCommentsForExpensesContext(ctx context.Context, expenseIDs []int64, workers int) (map[int64][]models.SplitwiseComment, error) {
+	return map[int64][]models.SplitwiseComment{}, nil
+}
+
+func (c *commentAPI) AddCommentToExpenseContext(ctx context.Context, expenseID int64, comment string) error {
+	return nil
+}
+
+func TestCommentStoreResolvesSyncUserOnce(t *testing.T) {
+	client := &commentAPI{}
+	store := NewCommentStore(client, 1, detector.Options{})
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := store.Load(context.Background(), []int64{1}); err != nil {
+				t.Errorf("Load() error = %v", err)
+			}
+			if err := store.SaveSync(context.Background(), models.SyncMetadata{SplitwiseExpenseID: 1}); err != nil {
+				t.Errorf("SaveSync() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := client.lookups.Load(); got != 1 {
+		t.Errorf("user looked up %d times, want 1", got)
+	}
+}
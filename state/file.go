@@ -0,0 +1,163 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jasmineyas/splitwise-lunchmoney/models"
+)
+
+// fileVersion is bumped when the layout of the state file changes.
+const fileVersion = 1
+
+// ErrNoStateFile is returned by OpenFileStore when the file doesn't exist.
+// Starting from an empty file would make every synced expense look new, so
+// the file has to be built from the Splitwise comments first.
+var ErrNoStateFile = errors.New("state file not found; build it with rebuild-state")
+
+// FileStore keeps state in a local JSON file, rewritten after every change.
+// It is safe for use by several goroutines but not by several processes.
+type FileStore struct {
+	path string
+
+	mu       sync.Mutex
+	expenses map[int64]models.ExpenseState
+}
+
+type stateFile struct {
+	Version  int                           `json:"version"`
+	Expenses map[int64]models.ExpenseState `json:"expenses"`
+}
+
+// OpenFileStore reads the state file at path.
+func OpenFileStore(path string) (*FileStore, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", path, ErrNoStateFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading state file: %w", err)
+	}
+
+	var file stateFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("decoding state file %s: %w", path, err)
+	}
+	if file.Version != fileVersion {
+		return nil, fmt.Errorf("state file %s has version %d, want %d", path, file.Version, fileVersion)
+	}
+	if file.Expenses == nil {
+		file.Expenses = make(map[int64]models.ExpenseState)
+	}
+
+	return &FileStore{path: path, expenses: file.Expenses}, nil
+}
+
+// CreateFileStore writes a new state file at path holding states, replacing
+// any file already there.
+func CreateFileStore(path string, states map[int64]models.ExpenseState) (*FileStore, error) {
+	s := &FileStore{path: path, expenses: make(map[int64]models.ExpenseState, len(states))}
+	for id, expenseState := range states {
+		s.expenses[id] = expenseState
+	}
+
+	if err := s.write(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileStore) Load(ctx context.Context, expenseIDs []int64) (map[int64]models.ExpenseState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	states := make(map[int64]models.ExpenseState, len(expenseIDs))
+	for _, id := range expenseIDs {
+		if expenseState, ok := s.expenses[id]; ok {
+			states[id] = expenseState
+		}
+	}
+	return states, nil
+}
+
+func (s *FileStore) SaveSync(ctx context.Context, metadata models.SyncMetadata) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expenseState := s.expenses[metadata.SplitwiseExpenseID]
+	expenseState.Sync = &metadata
+	expenseState.SyncedAt = recordedAt(metadata.SyncedAt)
+	expenseState.Legacy = false
+	return s.set(metadata.SplitwiseExpenseID, expenseState)
+}
+
+func (s *FileStore) SaveDeletion(ctx context.Context, metadata models.DeletionMetadata) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expenseState := s.expenses[metadata.SplitwiseExpenseID]
+	expenseState.Deletion = &metadata
+	expenseState.DeletedAt = recordedAt(metadata.DeletedFromLMAt)
+	return s.set(metadata.SplitwiseExpenseID, expenseState)
+}
+
+// set stores one expense's state and rewrites the file, putting the old
+// state back if the write fails.
+func (s *FileStore) set(expenseID int64, expenseState models.ExpenseState) error {
+	previous, existed := s.expenses[expenseID]
+	s.expenses[expenseID] = expenseState
+
+	if err := s.write(); err != nil {
+		if existed {
+			s.expenses[expenseID] = previous
+		} else {
+			delete(s.expenses, expenseID)
+		}
+		return err
+	}
+	return nil
+}
+
+// write saves the file through a temp file and rename, so a crash mid-write
+// never leaves a truncated state file behind.
+func (s *FileStore) write() error {
+	data, err := json.MarshalIndent(stateFile{Version: fileVersion, Expenses: s.expenses}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding state file: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("writing state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing state file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("writing state file: %w", err)
+	}
+	return nil
+}
+
+// recordedAt is the time a record counts from; the engine always sets one,
+// but a missing time must not sort before every other record.
+func recordedAt(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Now().UTC()
+	}
+	return t
+}
@@ -0,0 +1,72 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jasmineyas/splitwise-lunchmoney/models"
+)
+
+func TestOpenFileStoreMissing(t *testing.T) {
+	_, err := OpenFileStore(filepath.Join(t.TempDir(), "sync_state.json"))
+	if !errors.Is(err, ErrNoStateFile) {
+		t.Errorf("OpenFileStore() error = %v, want %v", err, ErrNoStateFile)
+	}
+}
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "sync_state.json")
+	syncedAt := time.Date(2025, 10, 11, 7, 0, 0, 0, time.UTC)
+	deletedAt := syncedAt.Add(time.Hour)
+
+	store, err := CreateFileStore(path, map[int64]models.ExpenseState{
+		1: {Legacy: true},
+	})
+	if err != nil {
+		t.Fatalf("CreateFileStore() error = %v", err)
+	}
+
+	sync := models.SyncMetadata{
+		SplitwiseExpenseID: 2,
+		SnapshotHash:       "abc",
+		SyncedAt:           syncedAt,
+		UserA:              models.UserSyncData{LMTransactionID: 12345},
+	}
+	if err := store.SaveSync(ctx, sync); err != nil {
+		t.Fatalf("SaveSync() error = %v", err)
+	}
+	if err := store.SaveDeletion(ctx, models.DeletionMetadata{SplitwiseExpenseID: 2, DeletedFromLMAt: deletedAt}); err != nil {
+		t.Fatalf("SaveDeletion() error = %v", err)
+	}
+
+	reopened, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileStore() error = %v", err)
+	}
+	states, err := reopened.Load(ctx, []int64{1, 2, 3})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if len(states) != 2 {
+		t.Fatalf("Load() returned %d states, want 2 (expense 3 was never synced)", len(states))
+	}
+	if !states[1].Legacy {
+		t.Errorf("expense 1 Legacy = false, want true")
+	}
+
+	got := states[2]
+	if got.Sync == nil || got.Sync.SnapshotHash != "abc" || got.Sync.UserA.LMTransactionID != 12345 {
+		t.Errorf("expense 2 Sync = %+v, want hash abc and transaction 12345", got.Sync)
+	}
+	if !got.SyncedAt.Equal(syncedAt) {
+		t.Errorf("expense 2 SyncedAt = %v, want %v", got.SyncedAt, syncedAt)
+	}
+	if got.Deletion == nil || !got.DeletedAt.Equal(deletedAt) {
+		t.Errorf("expense 2 deletion = %+v at %v, want one at %v", got.Deletion, got.DeletedAt, deletedAt)
+	}
+}
@@ -0,0 +1,26 @@
+// Pluggable storage for per-expense sync state
+
+package state
+
+import (
+	"context"
+
+	"github.com/jasmineyas/splitwise-lunchmoney/models"
+)
+
+// Store keeps what the sync recorded for each expense. CommentStore keeps it
+// in Splitwise comments, where both users and any machine can see it;
+// FileStore keeps it in a local file, which is much faster to read.
+type Store interface {
+	// Load returns the state of each expense. Expenses never synced are
+	// missing from the map. If some expenses can't be loaded the rest are
+	// still returned and the error is an *apierror.PartialError naming
+	// them. Treating those as never synced would create them twice, so
+	// they have to be skipped.
+	Load(ctx context.Context, expenseIDs []int64) (map[int64]models.ExpenseState, error)
+	// SaveSync records a sync, replacing the previous one.
+	SaveSync(ctx context.Context, metadata models.SyncMetadata) error
+	// SaveDeletion records that the expense's transactions were removed
+	// from Lunch Money.
+	SaveDeletion(ctx context.Context, metadata models.DeletionMetadata) error
+}
@@ -0,0 +1,30 @@
+package syncengine
+
+import (
+	"context"
+
+	"github.com/jasmineyas/splitwise-lunchmoney/lunchmoney"
+	"github.com/jasmineyas/splitwise-lunchmoney/models"
+	"github.com/jasmineyas/splitwise-lunchmoney/splitwise"
+	"github.com/jasmineyas/splitwise-lunchmoney/state"
+)
+
+// SplitwiseAPI is what the engine needs from Splitwise: the sync user, plus
+// the comment calls behind the default state.CommentStore. The fake package
+// has an in-memory implementation for tests.
+type SplitwiseAPI interface {
+	state.CommentAPI
+}
+
+// LunchMoneyAPI is what the engine needs from one user's Lunch Money budget.
+type LunchMoneyAPI interface {
+	GetTransactionsContext(ctx context.Context, startDate, endDate string, assetID int64, tag string) ([]models.LunchMoneyTransaction, error)
+	AddTransactionsContext(ctx context.Context, transactions []models.LunchMoneyTransaction) ([]string, error)
+	UpdateTransactionContext(ctx context.Context, transactionID int64, transaction models.LunchMoneyTransaction) error
+	DeleteTransactionContext(ctx context.Context, transactionID int64) error
+}
+
+var (
+	_ SplitwiseAPI  = (*splitwise.Client)(nil)
+	_ LunchMoneyAPI = (*lunchmoney.Client)(nil)
+)
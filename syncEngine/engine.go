@@ -1,92 +1,840 @@
 package syncengine
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jasmineyas/splitwise-lunchmoney/apierror"
 	"github.com/jasmineyas/splitwise-lunchmoney/config"
+	"github.com/jasmineyas/splitwise-lunchmoney/detector"
 	"github.com/jasmineyas/splitwise-lunchmoney/lunchmoney"
 	"github.com/jasmineyas/splitwise-lunchmoney/models"
-	"github.com/jasmineyas/splitwise-lunchmoney/splitwise"
+	"github.com/jasmineyas/splitwise-lunchmoney/state"
 )
 
+// maxTransactionsPerInsert is Lunch Money's limit for a single insert request.
+const maxTransactionsPerInsert = 500
+
+// ErrTokenRejected is returned by Sync when Splitwise or Lunch Money answered
+// 401. The run stops right away since every later call would fail the same
+// way; the token has to be replaced before syncing again.
+var ErrTokenRejected = errors.New("API token expired or revoked")
+
 type Engine struct {
-	swClient *splitwise.Client
-	lmClient *lunchmoney.Client
-	config   *config.Config
+	swClient  SplitwiseAPI
+	lmClientA LunchMoneyAPI
+	lmClientB LunchMoneyAPI
+	config    *config.Config
+	store     state.Store
+
+	mu            sync.Mutex // guards currentUserID while it's resolved
+	currentUserID int64
+}
+
+// Option configures an Engine.
+type Option func(*Engine)
+
+// WithStore records sync state in store. The default is Splitwise comments.
+func WithStore(store state.Store) Option {
+	return func(e *Engine) {
+		e.store = store
+	}
+}
+
+// WithCurrentUser sets the Splitwise user the engine runs as, for callers
+// that already looked it up.
+func WithCurrentUser(userID int64) Option {
+	return func(e *Engine) {
+		e.currentUserID = userID
+	}
+}
+
+// New builds an engine that writes every expense to both users' Lunch Money
+// budgets. User A is the authenticated Splitwise user.
+func New(swClient SplitwiseAPI, lmClientA, lmClientB LunchMoneyAPI, cfg *config.Config, opts ...Option) *Engine {
+	e := &Engine{
+		swClient:  swClient,
+		lmClientA: lmClientA,
+		lmClientB: lmClientB,
+		config:    cfg,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	if e.store == nil {
+		e.store = state.NewCommentStore(swClient, cfg.CommentWorkers, e.commentOptions())
+	}
+	return e
+}
+
+// userSide is one user's half of the sync: whose perspective the transaction
+// is built from, which budget it lands in and where its result is recorded.
+type userSide struct {
+	name        string
+	splitwiseID int64
+	lmConfig    config.LunchMoneyUserConfig
+	lmClient    LunchMoneyAPI
+	data        func(*models.SyncMetadata) *models.UserSyncData
+}
+
+func (e *Engine) sides(ctx context.Context) ([]userSide, error) {
+	userAID, err := e.CurrentUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return []userSide{
+		{
+			name:        "user A",
+			splitwiseID: userAID,
+			lmConfig:    e.config.UserALunchMoney,
+			lmClient:    e.lmClientA,
+			data:        func(m *models.SyncMetadata) *models.UserSyncData { return &m.UserA },
+		},
+		{
+			name:        "user B",
+			splitwiseID: e.config.UserBSplitwiseID,
+			lmConfig:    e.config.UserBLunchMoney,
+			lmClient:    e.lmClientB,
+			data:        func(m *models.SyncMetadata) *models.UserSyncData { return &m.UserB },
+		},
+	}, nil
+}
+
+// Result counts what one Sync call did, per expense.
+type Result struct {
+	Created     int
+	Updated     int
+	Deleted     int
+	Failed      int
+	Interrupted int // not started because ctx was cancelled or the run aborted
+
+	// Unfinished lists the expenses the next run has to see again: those
+	// counted in Failed or Interrupted, and those synced for one user with
+	// the other's error recorded for retry.
+	Unfinished []int64
+}
+
+func (r *Result) failed(expenseIDs ...int64) {
+	r.Failed += len(expenseIDs)
+	r.Unfinished = append(r.Unfinished, expenseIDs...)
+}
+
+func (r *Result) interrupted(expenseIDs ...int64) {
+	r.Interrupted += len(expenseIDs)
+	r.Unfinished = append(r.Unfinished, expenseIDs...)
+}
+
+// expenseIDs maps items to the Splitwise expense IDs they belong to.
+func expenseIDs[T any](items []T, id func(T) int64) []int64 {
+	ids := make([]int64, len(items))
+	for i, item := range items {
+		ids[i] = id(item)
+	}
+	return ids
+}
+
+func createID(expense models.SplitwiseExpense) int64 { return expense.ID }
+func updateID(action models.UpdateAction) int64      { return action.ExpenseID }
+func deleteID(action models.DeleteAction) int64      { return action.ExpenseID }
+
+// Sync applies all three lists. A failure in one list doesn't stop the
+// others; every error is returned joined.
+//
+// Cancelling ctx stops Sync between expenses: the expense in flight is
+// finished, including its sync state, and the rest are counted as
+// interrupted and picked up by the next run. A 401 from either API stops
+// Sync the same way and the returned error wraps ErrTokenRejected.
+func (e *Engine) Sync(ctx context.Context, toCreate []models.SplitwiseExpense, toUpdate []models.UpdateAction, toDelete []models.DeleteAction) (Result, error) {
+	ctx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
+
+	var result Result
+	err := errors.Join(
+		e.syncUpdate(ctx, abort, toUpdate, &result),
+		e.syncCreate(ctx, abort, toCreate, &result),
+		e.syncDelete(ctx, abort, toDelete, &result),
+	)
+	if cause := context.Cause(ctx); errors.Is(cause, ErrTokenRejected) {
+		err = errors.Join(cause, err)
+	}
+	return result, err
+}
+
+// abortOnAuth stops the run when err shows a token was rejected. Other API
+// errors only fail their expense; the user's Error is recorded in the sync
+// comment and the next run retries it.
+func abortOnAuth(err error, abort context.CancelCauseFunc) bool {
+	var apiErr *apierror.Error
+	if !errors.As(err, &apiErr) || !apiErr.Unauthorized() {
+		return false
+	}
+	abort(fmt.Errorf("%w: %s rejected the token, stopping sync", ErrTokenRejected, apiErr.Service))
+	return true
 }
 
-func New(swClient *splitwise.Client, lmClient *lunchmoney.Client, cfg *config.Config) *Engine {
-	return &Engine{
-		swClient: swClient,
-		lmClient: lmClient,
-		config:   cfg,
+// inFlight returns the context for the API calls of one expense. It ignores
+// cancellation, so a shutdown lets the expense finish and get its comment,
+// but keeps ctx's deadline so a stuck API can't hold the cycle forever.
+func inFlight(ctx context.Context) (context.Context, context.CancelFunc) {
+	detached := context.WithoutCancel(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(detached, deadline)
 	}
+	return detached, func() {}
+}
+
+// createItem tracks one expense through insert and comment.
+type createItem struct {
+	expense  models.SplitwiseExpense
+	metadata *models.SyncMetadata
 }
 
-// NTS
-// also let's understand the test http handler the crazy wrap what are they
-// goal tmr is to have a working integration test somewhere - either just running this
-// and see a new transaciton in splitwise is logged in luchmoney
-// the compare and update can come in the future :D
-// and find a place to deploy it
-// then we do feature update :D
+// pendingInsert is one user's transaction for one expense.
+type pendingInsert struct {
+	item        *createItem
+	transaction models.LunchMoneyTransaction
+}
 
-// NTS - work on this sync function
+func (e *Engine) syncCreate(ctx context.Context, abort context.CancelCauseFunc, toCreate []models.SplitwiseExpense, result *Result) error {
+	if len(toCreate) == 0 {
+		return nil
+	}
+	if ctx.Err() != nil {
+		result.interrupted(expenseIDs(toCreate, createID)...)
+		return nil
+	}
 
-func (e *Engine) Sync(toCreate []models.SplitwiseExpense, toUpdate []models.UpdateAction, toDelete []models.DeleteAction) error {
-	err := e.syncUpdate(toUpdate)
+	sides, err := e.sides(ctx)
 	if err != nil {
+		abortOnAuth(err, abort)
+		result.failed(expenseIDs(toCreate, createID)...)
 		return err
 	}
 
-	err = e.syncCreate(toCreate)
+	var errs []error
+	var items []*createItem
+
+	for _, expense := range toCreate {
+		snapshot, err := detector.NewExpenseSnapshot(expense)
+		if err != nil {
+			result.failed(expense.ID)
+			errs = append(errs, err)
+			continue
+		}
+
+		metadata := &models.SyncMetadata{
+			SplitwiseExpenseID: expense.ID,
+			SnapshotHash:       detector.HashSnapshot(snapshot),
+			Snapshot:           &snapshot,
+			SyncedBy:           sides[0].splitwiseID,
+		}
+		for _, side := range sides {
+			data := side.data(metadata)
+			data.SplitwiseUserID = side.splitwiseID
+			data.LMAssetID = side.lmConfig.SplitwiseAccountAssetID
+		}
+
+		items = append(items, &createItem{expense: expense, metadata: metadata})
+	}
+
+	// each user's transactions go to their own budget; one user failing
+	// doesn't stop the other. Creates are batched, so once the first insert
+	// is sent the whole batch is finished, comments included.
+	batchCtx, cancel := inFlight(ctx)
+	defer cancel()
+
+	for _, side := range sides {
+		var inserts []pendingInsert
+		for _, item := range items {
+			transaction, err := TransformSWToLMTransaction(item.expense, side.splitwiseID, side.lmConfig, e.transactionConfig())
+			if errors.Is(err, ErrNothingOwed) {
+				continue
+			}
+			if err != nil {
+				side.data(item.metadata).Error = err.Error()
+				errs = append(errs, fmt.Errorf("%s: %w", side.name, err))
+				continue
+			}
+			inserts = append(inserts, pendingInsert{item: item, transaction: transaction})
+		}
+
+		inserts, err := e.recoverExisting(batchCtx, side, inserts)
+		if err != nil {
+			errs = append(errs, err)
+			if abortOnAuth(err, abort) {
+				continue
+			}
+		}
+
+		for start := 0; start < len(inserts); start += maxTransactionsPerInsert {
+			end := min(start+maxTransactionsPerInsert, len(inserts))
+			if err := e.insertBatch(batchCtx, side, inserts[start:end]); err != nil {
+				errs = append(errs, err)
+				if abortOnAuth(err, abort) {
+					break
+				}
+			}
+		}
+	}
+
+	// record each expense's lunch money transaction ids in the store
+	for i, item := range items {
+		if !item.hasTransaction() {
+			// nothing landed in Lunch Money; if a user failed, leaving the
+			// expense uncommented means it's created again next run
+			if item.hasError() {
+				result.failed(item.expense.ID)
+			}
+			continue
+		}
+
+		item.metadata.SyncedAt = time.Now().UTC()
+		if err := e.store.SaveSync(batchCtx, *item.metadata); err != nil {
+			// the next run finds the transactions by external ID and only
+			// retries the comment
+			result.failed(item.expense.ID)
+			errs = append(errs, fmt.Errorf("expense %d: lunch money transactions created but %w", item.expense.ID, err))
+			if abortOnAuth(err, abort) {
+				for _, rest := range items[i+1:] {
+					result.failed(rest.expense.ID)
+				}
+				break
+			}
+			continue
+		}
+		result.Created++
+		if item.hasError() {
+			// the other user is retried once the expense is fetched again
+			result.Unfinished = append(result.Unfinished, item.expense.ID)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (item *createItem) hasTransaction() bool {
+	return item.metadata.UserA.LMTransactionID > 0 || item.metadata.UserB.LMTransactionID > 0
+}
+
+func (item *createItem) hasError() bool {
+	return item.metadata.UserA.Error != "" || item.metadata.UserB.Error != ""
+}
+
+// recoverExisting looks up transactions already in the user's Splitwise
+// asset by external ID. These come from a run that inserted them but crashed
+// or failed before the sync comment was posted; they are recorded on the
+// metadata so the comment gets backfilled instead of inserting a duplicate.
+// One that no longer matches the expense, e.g. because it was edited since,
+// is updated first. It returns the inserts that still need to happen, which
+// is none if the lookup failed.
+func (e *Engine) recoverExisting(ctx context.Context, side userSide, inserts []pendingInsert) ([]pendingInsert, error) {
+	if len(inserts) == 0 {
+		return nil, nil
+	}
+
+	startDate, endDate := inserts[0].transaction.Date, inserts[0].transaction.Date
+	for _, insert := range inserts[1:] {
+		startDate = min(startDate, insert.transaction.Date)
+		endDate = max(endDate, insert.transaction.Date)
+	}
+
+	byExternalID, err := lookupExisting(ctx, side, startDate, endDate)
+	if err != nil {
+		// inserting blind could duplicate, so wait for the next run
+		for _, insert := range inserts {
+			side.data(insert.item.metadata).Error = err.Error()
+		}
+		return nil, fmt.Errorf("%s: %w", side.name, err)
+	}
+
+	var remaining []pendingInsert
+	var errs []error
+	for _, insert := range inserts {
+		found, ok := byExternalID[insert.transaction.ExternalID]
+		if !ok {
+			remaining = append(remaining, insert)
+			continue
+		}
+
+		data := side.data(insert.item.metadata)
+		if err := adoptExisting(ctx, side, data, insert.transaction, found); err != nil {
+			data.Error = err.Error()
+			errs = append(errs, fmt.Errorf("%s: %w", side.name, err))
+		}
+	}
+
+	return remaining, errors.Join(errs...)
+}
+
+// adoptExisting records found, a transaction already in Lunch Money for the
+// expense, on data in place of inserting transaction. found is updated first
+// if it no longer matches transaction.
+func adoptExisting(ctx context.Context, side userSide, data *models.UserSyncData, transaction, found models.LunchMoneyTransaction) error {
+	data.LMTransactionID = found.ID
+
+	if !matchesTransaction(found, transaction) {
+		// as on any update, the status is left to the user
+		transaction.Status = ""
+		if err := side.lmClient.UpdateTransactionContext(ctx, found.ID, transaction); err != nil {
+			// the ID is still recorded, so the retry updates rather than inserts
+			return fmt.Errorf("updating recovered lunch money transaction %d: %w", found.ID, err)
+		}
+	}
+
+	requestBody, _ := json.Marshal(transaction)
+	responseBody, _ := json.Marshal(found)
+	data.LMRequestBody = string(requestBody)
+	data.LMResponseBody = string(responseBody)
+	data.LastSyncedAt = time.Now().Unix()
+	data.Error = ""
+	return nil
+}
+
+// lookupExisting reads the transactions in the user's Splitwise asset between
+// the two dates, keyed by external ID. It only reads, so Plan uses it too.
+func lookupExisting(ctx context.Context, side userSide, startDate, endDate string) (map[string]models.LunchMoneyTransaction, error) {
+	existing, err := side.lmClient.GetTransactionsContext(ctx, startDate, endDate, side.lmConfig.SplitwiseAccountAssetID, "")
 	if err != nil {
+		return nil, fmt.Errorf("looking up existing lunch money transactions: %w", err)
+	}
+
+	byExternalID := make(map[string]models.LunchMoneyTransaction, len(existing))
+	for _, transaction := range existing {
+		if transaction.ExternalID != "" && transaction.ID > 0 {
+			byExternalID[transaction.ExternalID] = transaction
+		}
+	}
+	return byExternalID, nil
+}
+
+// matchesTransaction reports whether a transaction read back from Lunch Money
+// already says what want would write, ignoring the status.
+func matchesTransaction(got, want models.LunchMoneyTransaction) bool {
+	gotCents, gotErr := models.ParseCents(got.Amount)
+	wantCents, wantErr := models.ParseCents(want.Amount)
+	if gotErr != nil || wantErr != nil || gotCents != wantCents {
+		return false
+	}
+
+	gotTags, wantTags := slices.Clone(got.Tags), slices.Clone(want.Tags)
+	slices.Sort(gotTags)
+	slices.Sort(wantTags)
+
+	return got.Date == want.Date &&
+		got.Payee == want.Payee &&
+		strings.EqualFold(got.Currency, want.Currency) &&
+		got.Notes == want.Notes &&
+		slices.Equal(gotTags, wantTags)
+}
+
+// insertBatch adds one user's transactions and records the outcome on each
+// expense's metadata.
+func (e *Engine) insertBatch(ctx context.Context, side userSide, batch []pendingInsert) error {
+	transactions := make([]models.LunchMoneyTransaction, len(batch))
+	for i, insert := range batch {
+		transactions[i] = insert.transaction
+	}
+
+	ids, err := side.lmClient.AddTransactionsContext(ctx, transactions)
+	if err == nil && len(ids) != len(batch) {
+		err = fmt.Errorf("lunch money returned %d IDs for %d transactions", len(ids), len(batch))
+	}
+	if err != nil {
+		for _, insert := range batch {
+			side.data(insert.item.metadata).Error = err.Error()
+		}
+		return fmt.Errorf("%s: adding %d transactions to lunch money: %w", side.name, len(batch), err)
+	}
+
+	var errs []error
+	now := time.Now().UTC()
+	for i, insert := range batch {
+		data := side.data(insert.item.metadata)
+
+		lmID, err := strconv.ParseInt(ids[i], 10, 64)
+		if err != nil {
+			data.Error = fmt.Sprintf("invalid lunch money transaction ID %q", ids[i])
+			errs = append(errs, fmt.Errorf("%s: expense %d: %s", side.name, insert.item.expense.ID, data.Error))
+			continue
+		}
+
+		requestBody, _ := json.Marshal(insert.transaction)
+		responseBody, _ := json.Marshal(struct {
+			IDs []string `json:"ids"`
+		}{IDs: []string{ids[i]}})
+
+		data.LMTransactionID = lmID
+		data.LMRequestBody = string(requestBody)
+		data.LMResponseBody = string(responseBody)
+		data.LastSyncedAt = now.Unix()
+		data.Error = ""
+	}
+
+	return errors.Join(errs...)
+}
+
+// CurrentUserID resolves the authenticated Splitwise user once; everything is
+// synced from their perspective and only their sync comments are trusted.
+func (e *Engine) CurrentUserID(ctx context.Context) (int64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.currentUserID != 0 {
+		return e.currentUserID, nil
+	}
+
+	user, err := e.swClient.GetUserInfoContext(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("fetching current splitwise user: %w", err)
+	}
+
+	e.currentUserID = user.ID
+	return e.currentUserID, nil
+}
+
+// syncUpdate pushes edited expenses to the Lunch Money transactions recorded
+// in their sync comment, then appends a new sync comment carrying the new
+// hash. It also retries users whose earlier sync failed.
+func (e *Engine) syncUpdate(ctx context.Context, abort context.CancelCauseFunc, toUpdate []models.UpdateAction, result *Result) error {
+	if len(toUpdate) == 0 {
+		return nil
+	}
+	if ctx.Err() != nil {
+		result.interrupted(expenseIDs(toUpdate, updateID)...)
+		return nil
+	}
+
+	sides, err := e.sides(ctx)
+	if err != nil {
+		abortOnAuth(err, abort)
+		result.failed(expenseIDs(toUpdate, updateID)...)
 		return err
 	}
 
-	err = e.syncDelete(toDelete)
+	var errs []error
+	for i, action := range toUpdate {
+		if ctx.Err() != nil {
+			result.interrupted(expenseIDs(toUpdate[i:], updateID)...)
+			break
+		}
+
+		if err := e.updateExpense(ctx, sides, action); err != nil {
+			result.failed(action.ExpenseID)
+			errs = append(errs, fmt.Errorf("expense %d: %w", action.ExpenseID, err))
+			abortOnAuth(err, abort)
+			continue
+		}
+		result.Updated++
+	}
+
+	return errors.Join(errs...)
+}
+
+func (e *Engine) updateExpense(ctx context.Context, sides []userSide, action models.UpdateAction) error {
+	ctx, cancel := inFlight(ctx)
+	defer cancel()
+
+	snapshot, err := detector.NewExpenseSnapshot(action.Expense)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	metadata := action.SyncData
+	var errs []error
+	succeeded := false
+
+	for _, side := range sides {
+		data := side.data(&metadata)
+		if data.SplitwiseUserID == 0 {
+			data.SplitwiseUserID = side.splitwiseID
+			data.LMAssetID = side.lmConfig.SplitwiseAccountAssetID
+		}
+
+		changed, err := e.updateSide(ctx, side, data, action.Expense)
+		if err != nil {
+			data.Error = err.Error()
+			errs = append(errs, fmt.Errorf("%s: %w", side.name, err))
+			continue
+		}
+		succeeded = succeeded || changed
+	}
+
+	if len(errs) > 0 && !succeeded {
+		// keep the old comment so the whole update is retried next run
+		return errors.Join(errs...)
+	}
+
+	metadata.SnapshotHash = detector.HashSnapshot(snapshot)
+	metadata.Snapshot = &snapshot
+	metadata.SyncedAt = time.Now().UTC()
+	metadata.SyncedBy = sides[0].splitwiseID
+
+	// users that failed keep their Error, which makes the detector retry them
+	errs = append(errs, e.store.SaveSync(ctx, metadata))
+	return errors.Join(errs...)
 }
 
-func (e *Engine) syncCreate(toCreate []models.SplitwiseExpense) error {
-	// transform a list of Splitwise expenses to LunchMoney transactions
+// updateSide brings one user's transaction in line with the expense,
+// inserting it if the user had none yet or adopting the one a failed insert
+// left behind. It reports whether the user's transaction was recorded anew.
+func (e *Engine) updateSide(ctx context.Context, side userSide, data *models.UserSyncData, expense models.SplitwiseExpense) (bool, error) {
+	transaction, ok, err := e.updatedTransaction(side, *data, expense)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		data.Error = ""
+		return false, nil
+	}
 
-	// post the transactions to lunch money
+	if data.LMTransactionID > 0 {
+		// the status is only set on insert; reconciling in Lunch Money
+		// clears transactions, and an edit must not flip them back
+		transaction.Status = ""
+	} else {
+		// a failed insert may still have landed, e.g. when the response
+		// timed out, so look for it before inserting again
+		byExternalID, err := lookupExisting(ctx, side, transaction.Date, transaction.Date)
+		if err != nil {
+			return false, err
+		}
+		if found, ok := byExternalID[transaction.ExternalID]; ok {
+			if err := adoptExisting(ctx, side, data, transaction, found); err != nil {
+				return false, err
+			}
+			return true, nil
+		}
+	}
 
-	// post a comment to splitwise expense with lunch money transaction id
-	return nil
+	requestBody, err := json.Marshal(transaction)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal transaction: %w", err)
+	}
+
+	if data.LMTransactionID > 0 {
+		if err := side.lmClient.UpdateTransactionContext(ctx, data.LMTransactionID, transaction); err != nil {
+			return false, fmt.Errorf("updating lunch money transaction %d: %w", data.LMTransactionID, err)
+		}
+		data.LMResponseBody = `{"updated":true}`
+	} else {
+		ids, err := side.lmClient.AddTransactionsContext(ctx, []models.LunchMoneyTransaction{transaction})
+		if err != nil {
+			return false, fmt.Errorf("adding lunch money transaction: %w", err)
+		}
+		if len(ids) != 1 {
+			return false, fmt.Errorf("lunch money returned %d IDs for 1 transaction", len(ids))
+		}
+		lmID, err := strconv.ParseInt(ids[0], 10, 64)
+		if err != nil {
+			return false, fmt.Errorf("invalid lunch money transaction ID %q: %w", ids[0], err)
+		}
+		responseBody, _ := json.Marshal(struct {
+			IDs []string `json:"ids"`
+		}{IDs: ids})
+
+		data.LMTransactionID = lmID
+		data.LMResponseBody = string(responseBody)
+	}
+
+	data.LMRequestBody = string(requestBody)
+	data.LastSyncedAt = time.Now().Unix()
+	data.Error = ""
+	return true, nil
 }
 
-// to come
-func (e *Engine) syncUpdate(toUpdate []models.UpdateAction) error {
-	//  compare existing splitwise expense with the expense in the comment
-	return nil
+// syncDelete removes the Lunch Money transactions of deleted Splitwise
+// expenses, either hard deleting them or zeroing them out depending on
+// config.DeleteMode, then records the deletion in the store.
+func (e *Engine) syncDelete(ctx context.Context, abort context.CancelCauseFunc, toDelete []models.DeleteAction, result *Result) error {
+	if len(toDelete) == 0 {
+		return nil
+	}
+	if ctx.Err() != nil {
+		result.interrupted(expenseIDs(toDelete, deleteID)...)
+		return nil
+	}
+
+	sides, err := e.sides(ctx)
+	if err != nil {
+		abortOnAuth(err, abort)
+		result.failed(expenseIDs(toDelete, deleteID)...)
+		return err
+	}
+
+	var errs []error
+	for i, action := range toDelete {
+		if ctx.Err() != nil {
+			result.interrupted(expenseIDs(toDelete[i:], deleteID)...)
+			break
+		}
+
+		if err := e.deleteExpense(ctx, sides, action); err != nil {
+			result.failed(action.ExpenseID)
+			errs = append(errs, fmt.Errorf("expense %d: %w", action.ExpenseID, err))
+			abortOnAuth(err, abort)
+			continue
+		}
+		result.Deleted++
+	}
+
+	return errors.Join(errs...)
 }
 
-// to come
-func (e *Engine) syncDelete(toDelete []models.DeleteAction) error {
-	//  placeholder implementation
-	return nil
+func (e *Engine) deleteExpense(ctx context.Context, sides []userSide, action models.DeleteAction) error {
+	ctx, cancel := inFlight(ctx)
+	defer cancel()
+
+	now := time.Now().UTC()
+
+	// remaining tracks what is still in Lunch Money if a user fails
+	remaining := action.SyncData
+	var errs []error
+
+	for _, side := range sides {
+		data := side.data(&remaining)
+		if data.LMTransactionID <= 0 {
+			continue
+		}
+
+		if err := e.removeTransaction(ctx, side, *data); err != nil {
+			data.Error = err.Error()
+			errs = append(errs, fmt.Errorf("%s: %w", side.name, err))
+			continue
+		}
+		data.LMTransactionID = 0
+		data.LastSyncedAt = now.Unix()
+		data.Error = ""
+	}
+
+	if len(errs) > 0 {
+		// record the users already removed so the retry only touches the rest
+		remaining.SyncedAt = now
+		if err := e.store.SaveSync(ctx, remaining); err != nil {
+			errs = append(errs, err)
+		}
+		return errors.Join(errs...)
+	}
+
+	metadata := models.DeletionMetadata{
+		SplitwiseExpenseID: action.ExpenseID,
+		DeletedFromLMAt:    now,
+		DeletedBy:          sides[0].splitwiseID,
+		Mode:               e.config.DeleteMode,
+		UserA:              action.SyncData.UserA,
+		UserB:              action.SyncData.UserB,
+	}
+
+	return e.store.SaveDeletion(ctx, metadata)
 }
 
-// dont worry about generate snapshot hash etc. for now.
+// removeTransaction deletes or zeroes one user's Lunch Money transaction. A
+// transaction Lunch Money no longer has counts as removed.
+func (e *Engine) removeTransaction(ctx context.Context, side userSide, data models.UserSyncData) error {
+	if e.config.DeleteMode == config.DeleteModeDelete {
+		if err := side.lmClient.DeleteTransactionContext(ctx, data.LMTransactionID); err != nil && !apierror.IsNotFound(err) {
+			return fmt.Errorf("deleting lunch money transaction %d: %w", data.LMTransactionID, err)
+		}
+		return nil
+	}
 
-func TransformSWToLMTransaction() error {
-	// will come back to this later
+	transaction, err := e.deletedTransaction(data)
+	if err != nil {
+		return err
+	}
 
+	if err := side.lmClient.UpdateTransactionContext(ctx, data.LMTransactionID, transaction); err != nil && !apierror.IsNotFound(err) {
+		return fmt.Errorf("zeroing lunch money transaction %d: %w", data.LMTransactionID, err)
+	}
 	return nil
 }
 
-func PostTransactionToLunchMoney() error {
-	return nil
+// updatedTransaction works out what one user's transaction should look like
+// after an edit. ok is false when the user has nothing in Lunch Money and
+// still owes nothing, so there's nothing to write.
+func (e *Engine) updatedTransaction(side userSide, data models.UserSyncData, expense models.SplitwiseExpense) (transaction models.LunchMoneyTransaction, ok bool, err error) {
+	transaction, err = TransformSWToLMTransaction(expense, side.splitwiseID, side.lmConfig, e.transactionConfig())
+	switch {
+	case errors.Is(err, ErrNothingOwed) && data.LMTransactionID > 0:
+		// the edit removed this user from the expense
+		transaction, err = zeroedTransaction(data)
+		if err != nil {
+			return models.LunchMoneyTransaction{}, false, err
+		}
+	case errors.Is(err, ErrNothingOwed):
+		return models.LunchMoneyTransaction{}, false, nil
+	case err != nil:
+		return models.LunchMoneyTransaction{}, false, err
+	}
+
+	return transaction, true, nil
 }
 
-func PostCommentToSplitwise() error {
-	return nil
+// deletedTransaction is the zeroed-out, tagged transaction that replaces a
+// deleted expense when DeleteMode is zero.
+func (e *Engine) deletedTransaction(data models.UserSyncData) (models.LunchMoneyTransaction, error) {
+	transaction, err := zeroedTransaction(data)
+	if err != nil {
+		return models.LunchMoneyTransaction{}, err
+	}
+
+	// like any update, leave the status to whoever reconciles in Lunch Money
+	transaction.Status = ""
+	// the prefix can push notes that were at the limit over it
+	transaction.Notes = truncateNotes("Deleted in Splitwise\n" + transaction.Notes)
+	deletedTag := e.transactionConfig().Tags.Deleted
+	if !slices.Contains(transaction.Tags, deletedTag) {
+		transaction.Tags = append(transaction.Tags, deletedTag)
+	}
+	return transaction, nil
 }
 
-func GenerateSnapshotHash() error {
-	return nil
+// transactionConfig and commentOptions fall back to the defaults for a
+// config that was built by hand rather than loaded.
+func (e *Engine) transactionConfig() config.TransactionConfig {
+	if e.config.Transactions == (config.TransactionConfig{}) {
+		return config.DefaultTransactionConfig(e.config.TestMode)
+	}
+	return e.config.Transactions
+}
+
+func (e *Engine) commentOptions() detector.Options {
+	comments := e.config.Comments
+	if comments == (config.CommentConfig{}) {
+		comments = config.DefaultCommentConfig(e.config.TestMode)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return detector.NewOptions(comments, e.currentUserID)
+}
+
+// truncateNotes cuts notes down to what Lunch Money accepts, marking the cut
+// with an ellipsis.
+func truncateNotes(notes string) string {
+	if utf8.RuneCountInString(notes) <= lunchmoney.MaxNotesLength {
+		return notes
+	}
+	return string([]rune(notes)[:lunchmoney.MaxNotesLength-1]) + "…"
+}
+
+// zeroedTransaction rebuilds the last transaction sent for a user with a zero
+// amount. Starting from the stored request body keeps the update from
+// blanking the other fields.
+func zeroedTransaction(data models.UserSyncData) (models.LunchMoneyTransaction, error) {
+	var transaction models.LunchMoneyTransaction
+	if err := json.Unmarshal([]byte(data.LMRequestBody), &transaction); err != nil {
+		return models.LunchMoneyTransaction{}, fmt.Errorf("decoding last request body for transaction %d: %w", data.LMTransactionID, err)
+	}
+
+	transaction.Amount = models.FormatCents(0)
+	return transaction, nil
 }
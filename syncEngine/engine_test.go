@@ -0,0 +1,116 @@
+package syncengine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jasmineyas/splitwise-lunchmoney/apierror"
+	"github.com/jasmineyas/splitwise-lunchmoney/config"
+	"github.com/jasmineyas/splitwise-lunchmoney/models"
+	"github.com/jasmineyas/splitwise-lunchmoney/syncEngine/fake"
+)
+
+func TestSyncCancelledBeforeStart(t *testing.T) {
+	// the user ID is already resolved and no client is set, so any API call
+	// would panic
+	engine := &Engine{config: &config.Config{DeleteMode: config.DeleteModeZero}, currentUserID: jasmineID}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err := engine.Sync(ctx,
+		[]models.SplitwiseExpense{{ID: 1}, {ID: 2}},
+		[]models.UpdateAction{{ExpenseID: 3}},
+		[]models.DeleteAction{{ExpenseID: 4}, {ExpenseID: 5}, {ExpenseID: 6}},
+	)
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	want := Result{Interrupted: 6, Unfinished: []int64{3, 1, 2, 4, 5, 6}}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("Sync() result = %+v, want %+v", result, want)
+	}
+}
+
+func TestInFlight(t *testing.T) {
+	t.Run("ignores cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		inflight, done := inFlight(ctx)
+		defer done()
+
+		if err := inflight.Err(); err != nil {
+			t.Errorf("inFlight() context error = %v, want nil", err)
+		}
+	})
+
+	t.Run("keeps the deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+		<-ctx.Done()
+
+		inflight, done := inFlight(ctx)
+		defer done()
+
+		if err := inflight.Err(); err != context.DeadlineExceeded {
+			t.Errorf("inFlight() context error = %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+}
+
+func TestAbortOnAuth(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantAbort bool
+	}{
+		{name: "token rejected", err: fmt.Errorf("user A: %w", &apierror.Error{Service: apierror.LunchMoney, StatusCode: http.StatusUnauthorized}), wantAbort: true},
+		{name: "not found", err: &apierror.Error{Service: apierror.LunchMoney, StatusCode: http.StatusNotFound}},
+		{name: "server error", err: &apierror.Error{Service: apierror.Splitwise, StatusCode: http.StatusBadGateway}},
+		{name: "network error", err: errors.New("connection reset")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, abort := context.WithCancelCause(context.Background())
+			defer abort(nil)
+
+			if got := abortOnAuth(tt.err, abort); got != tt.wantAbort {
+				t.Errorf("abortOnAuth() = %v, want %v", got, tt.wantAbort)
+			}
+			if aborted := errors.Is(context.Cause(ctx), ErrTokenRejected); aborted != tt.wantAbort {
+				t.Errorf("run aborted = %v, want %v", aborted, tt.wantAbort)
+			}
+		})
+	}
+}
+
+func TestCurrentUserIDResolvedOnce(t *testing.T) {
+	sw := fake.NewSplitwise(jasmineID)
+	engine := New(sw, fake.NewLunchMoney(), fake.NewLunchMoney(), &config.Config{})
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if id, err := engine.CurrentUserID(context.Background()); err != nil || id != jasmineID {
+				t.Errorf("CurrentUserID() = %d, %v; want %d", id, err, jasmineID)
+			}
+			engine.commentOptions()
+		}()
+	}
+	wg.Wait()
+
+	if calls := sw.Calls(); len(calls) != 1 {
+		t.Errorf("user looked up %d times, want 1: %v", len(calls), calls)
+	}
+}
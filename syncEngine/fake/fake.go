@@ -0,0 +1,300 @@
+// In-memory Splitwise and Lunch Money clients for testing the sync engine
+
+package fake
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jasmineyas/splitwise-lunchmoney/apierror"
+	"github.com/jasmineyas/splitwise-lunchmoney/models"
+)
+
+// Splitwise stands in for *splitwise.Client. Comments posted through it
+// can be read back, so the default comment store works against it.
+type Splitwise struct {
+	mu sync.Mutex
+
+	User     models.User
+	Friends  map[int64]models.User
+	Comments map[int64][]models.SplitwiseComment
+	// Errs makes every call to the named method fail, e.g.
+	// Errs["AddCommentToExpense"].
+	Errs map[string]error
+
+	calls         []string
+	nextCommentID int64
+}
+
+// NewSplitwise returns a fake authenticated as userID, with no friends or
+// comments.
+func NewSplitwise(userID int64) *Splitwise {
+	return &Splitwise{
+		User:          models.User{ID: userID},
+		Friends:       make(map[int64]models.User),
+		Comments:      make(map[int64][]models.SplitwiseComment),
+		Errs:          make(map[string]error),
+		nextCommentID: 1,
+	}
+}
+
+// Calls lists every call made so far, like "AddCommentToExpense(42)".
+func (f *Splitwise) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+// CommentsOn returns the comments on one expense, oldest first.
+func (f *Splitwise) CommentsOn(expenseID int64) []models.SplitwiseComment {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]models.SplitwiseComment(nil), f.Comments[expenseID]...)
+}
+
+func (f *Splitwise) GetUserInfoContext(ctx context.Context) (*models.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("GetUserInfo", nil); err != nil {
+		return nil, err
+	}
+	user := f.User
+	return &user, nil
+}
+
+func (f *Splitwise) GetFriendContext(ctx context.Context, friendID int64) (*models.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("GetFriend", friendID); err != nil {
+		return nil, err
+	}
+	friend, ok := f.Friends[friendID]
+	if !ok {
+		return nil, &apierror.Error{Service: apierror.Splitwise, StatusCode: http.StatusNotFound}
+	}
+	return &friend, nil
+}
+
+func (f *Splitwise) GetCommentsForExpensesContext(ctx context.Context, expenseIDs []int64, workers int) (map[int64][]models.SplitwiseComment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	comments := make(map[int64][]models.SplitwiseComment, len(expenseIDs))
+	failed := make(map[int64]error)
+	for _, id := range expenseIDs {
+		if err := f.record("GetExpenseComments", id); err != nil {
+			failed[id] = err
+			continue
+		}
+		comments[id] = append([]models.SplitwiseComment(nil), f.Comments[id]...)
+	}
+
+	if len(failed) > 0 {
+		return comments, &apierror.PartialError{Op: "fetching comments", Failed: failed, Total: len(expenseIDs)}
+	}
+	return comments, nil
+}
+
+func (f *Splitwise) AddCommentToExpenseContext(ctx context.Context, expenseID int64, comment string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("AddCommentToExpense", expenseID); err != nil {
+		return err
+	}
+
+	// space the comments out so "latest wins" is well defined
+	createdAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(f.nextCommentID) * time.Minute)
+	f.Comments[expenseID] = append(f.Comments[expenseID], models.SplitwiseComment{
+		ID:        f.nextCommentID,
+		Content:   comment,
+		User:      f.User,
+		CreatedAt: createdAt,
+	})
+	f.nextCommentID++
+	return nil
+}
+
+func (f *Splitwise) record(method string, arg any) error {
+	if arg == nil {
+		f.calls = append(f.calls, method+"()")
+	} else {
+		f.calls = append(f.calls, fmt.Sprintf("%s(%v)", method, arg))
+	}
+	return f.Errs[method]
+}
+
+// LunchMoney stands in for one user's *lunchmoney.Client. Like the real API
+// it rejects a second transaction with the same external ID in an asset and
+// answers 404 for transactions it doesn't have.
+type LunchMoney struct {
+	mu sync.Mutex
+
+	Transactions map[int64]models.LunchMoneyTransaction
+	Assets       []int64
+	// Errs makes every call to the named method fail, e.g.
+	// Errs["AddTransactions"].
+	Errs map[string]error
+
+	calls  []string
+	nextID int64
+}
+
+// NewLunchMoney returns a fake with no assets or transactions.
+func NewLunchMoney() *LunchMoney {
+	return &LunchMoney{
+		Transactions: make(map[int64]models.LunchMoneyTransaction),
+		Errs:         make(map[string]error),
+		nextID:       1000,
+	}
+}
+
+// Calls lists every call made so far, like "UpdateTransaction(1000)".
+func (f *LunchMoney) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+// Transaction returns one stored transaction.
+func (f *LunchMoney) Transaction(id int64) (models.LunchMoneyTransaction, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	transaction, ok := f.Transactions[id]
+	return transaction, ok
+}
+
+// Put stores a transaction as if it had been inserted earlier and returns
+// its ID.
+func (f *LunchMoney) Put(transaction models.LunchMoneyTransaction) int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	transaction.ID = f.nextID
+	f.nextID++
+	f.Transactions[transaction.ID] = transaction
+	return transaction.ID
+}
+
+func (f *LunchMoney) VerifyAssetExistContext(ctx context.Context, assetID int64) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("VerifyAssetExist", assetID); err != nil {
+		return false, err
+	}
+	return slices.Contains(f.Assets, assetID), nil
+}
+
+func (f *LunchMoney) GetTransactionsContext(ctx context.Context, startDate, endDate string, assetID int64, tag string) ([]models.LunchMoneyTransaction, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("GetTransactions", assetID); err != nil {
+		return nil, err
+	}
+
+	var transactions []models.LunchMoneyTransaction
+	for _, transaction := range f.Transactions {
+		if assetID > 0 && transaction.AssetID != assetID {
+			continue
+		}
+		if startDate != "" && (transaction.Date < startDate || transaction.Date > endDate) {
+			continue
+		}
+		if tag != "" && !slices.Contains(transaction.Tags, tag) {
+			continue
+		}
+		transactions = append(transactions, transaction)
+	}
+	return transactions, nil
+}
+
+func (f *LunchMoney) AddTransactionsContext(ctx context.Context, transactions []models.LunchMoneyTransaction) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("AddTransactions", len(transactions)); err != nil {
+		return nil, err
+	}
+
+	for i, transaction := range transactions {
+		if transaction.ExternalID == "" {
+			continue
+		}
+		for _, existing := range f.Transactions {
+			if existing.ExternalID == transaction.ExternalID && existing.AssetID == transaction.AssetID {
+				return nil, &apierror.Error{
+					Service:    apierror.LunchMoney,
+					StatusCode: http.StatusOK,
+					Errors:     []string{fmt.Sprintf("Transaction %d has a duplicate external_id: %s", i, transaction.ExternalID)},
+				}
+			}
+		}
+	}
+
+	ids := make([]string, len(transactions))
+	for i, transaction := range transactions {
+		transaction.ID = f.nextID
+		f.nextID++
+		f.Transactions[transaction.ID] = transaction
+		ids[i] = strconv.FormatInt(transaction.ID, 10)
+	}
+	return ids, nil
+}
+
+func (f *LunchMoney) UpdateTransactionContext(ctx context.Context, transactionID int64, transaction models.LunchMoneyTransaction) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("UpdateTransaction", transactionID); err != nil {
+		return err
+	}
+	existing, ok := f.Transactions[transactionID]
+	if !ok {
+		return notFound(transactionID)
+	}
+
+	// Lunch Money keeps the status when an update leaves it out
+	if transaction.Status == "" {
+		transaction.Status = existing.Status
+	}
+	transaction.ID = transactionID
+	f.Transactions[transactionID] = transaction
+	return nil
+}
+
+func (f *LunchMoney) DeleteTransactionContext(ctx context.Context, transactionID int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("DeleteTransaction", transactionID); err != nil {
+		return err
+	}
+	if _, ok := f.Transactions[transactionID]; !ok {
+		return notFound(transactionID)
+	}
+
+	delete(f.Transactions, transactionID)
+	return nil
+}
+
+func (f *LunchMoney) record(method string, arg any) error {
+	f.calls = append(f.calls, fmt.Sprintf("%s(%v)", method, arg))
+	return f.Errs[method]
+}
+
+func notFound(transactionID int64) error {
+	return &apierror.Error{
+		Service:    apierror.LunchMoney,
+		StatusCode: http.StatusNotFound,
+		Errors:     []string{fmt.Sprintf("Transaction %d not found", transactionID)},
+	}
+}
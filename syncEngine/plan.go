@@ -0,0 +1,323 @@
+package syncengine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jasmineyas/splitwise-lunchmoney/config"
+	"github.com/jasmineyas/splitwise-lunchmoney/detector"
+	"github.com/jasmineyas/splitwise-lunchmoney/models"
+)
+
+// What a plan would do to one user's Lunch Money transaction.
+const (
+	PlanInsert = "insert"
+	PlanUpdate = "update"
+	PlanZero   = "zero"
+	PlanDelete = "delete"
+	PlanSkip   = "skip"
+	// PlanRecover records a transaction an earlier run inserted without
+	// commenting; nothing is written to Lunch Money.
+	PlanRecover = "recover"
+)
+
+// Plan is everything Sync would do for the same input, without doing it.
+type Plan struct {
+	TestMode bool            `json:"test_mode"`
+	Creates  []PlannedChange `json:"creates"`
+	Updates  []PlannedChange `json:"updates"`
+	Deletes  []PlannedChange `json:"deletes"`
+}
+
+// PlannedChange is one Splitwise expense and what happens to it on each side.
+type PlannedChange struct {
+	ExpenseID     int64             `json:"expense_id"`
+	Description   string            `json:"description"`
+	ChangedFields []string          `json:"changed_fields,omitempty"`
+	Users         []PlannedLMChange `json:"users"`
+	// Comment is the text that would be posted to the Splitwise expense.
+	// Lunch Money IDs of transactions not inserted yet show as 0.
+	Comment string `json:"comment,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// PlannedLMChange is one Lunch Money write for one user.
+type PlannedLMChange struct {
+	User            string          `json:"user"`
+	SplitwiseUserID int64           `json:"splitwise_user_id"`
+	Action          string          `json:"action"`
+	LMTransactionID int64           `json:"lm_transaction_id,omitempty"`
+	RequestBody     json.RawMessage `json:"request_body,omitempty"`
+	Error           string          `json:"error,omitempty"`
+}
+
+// Plan runs the same transforms as Sync and reports the Lunch Money request
+// bodies and Splitwise comments it would send. Like Sync, creates are first
+// looked up by external ID in each user's Splitwise asset. Nothing is
+// written; the only calls made are reads.
+func (e *Engine) Plan(ctx context.Context, toCreate []models.SplitwiseExpense, toUpdate []models.UpdateAction, toDelete []models.DeleteAction) (Plan, error) {
+	plan := Plan{
+		TestMode: e.config.TestMode,
+		Creates:  []PlannedChange{},
+		Updates:  []PlannedChange{},
+		Deletes:  []PlannedChange{},
+	}
+
+	sides, err := e.sides(ctx)
+	if err != nil {
+		return plan, err
+	}
+
+	existing := make([]existingLookup, len(sides))
+	if len(toCreate) > 0 {
+		startDate, endDate := createDateRange(toCreate)
+		for i, side := range sides {
+			existing[i].byExternalID, existing[i].err = lookupExisting(ctx, side, startDate, endDate)
+		}
+	}
+
+	for _, expense := range toCreate {
+		plan.Creates = append(plan.Creates, e.planCreate(sides, existing, expense))
+	}
+	for _, action := range toUpdate {
+		plan.Updates = append(plan.Updates, e.planUpdate(sides, action))
+	}
+	for _, action := range toDelete {
+		plan.Deletes = append(plan.Deletes, e.planDelete(sides, action))
+	}
+
+	return plan, nil
+}
+
+// existingLookup is one user's transactions by external ID, or why they
+// couldn't be read.
+type existingLookup struct {
+	byExternalID map[string]models.LunchMoneyTransaction
+	err          error
+}
+
+// createDateRange spans the dates of the transactions the expenses turn into.
+func createDateRange(expenses []models.SplitwiseExpense) (startDate, endDate string) {
+	for i, expense := range expenses {
+		date := expense.Date.Format("2006-01-02")
+		if i == 0 {
+			startDate, endDate = date, date
+			continue
+		}
+		startDate = min(startDate, date)
+		endDate = max(endDate, date)
+	}
+	return startDate, endDate
+}
+
+// planCreate plans one expense's inserts. existing holds each side's lookup,
+// in the order of sides.
+func (e *Engine) planCreate(sides []userSide, existing []existingLookup, expense models.SplitwiseExpense) PlannedChange {
+	change := PlannedChange{ExpenseID: expense.ID, Description: expense.Description}
+
+	snapshot, err := detector.NewExpenseSnapshot(expense)
+	if err != nil {
+		change.Error = err.Error()
+		return change
+	}
+
+	metadata := models.SyncMetadata{
+		SplitwiseExpenseID: expense.ID,
+		SnapshotHash:       detector.HashSnapshot(snapshot),
+		Snapshot:           &snapshot,
+		SyncedAt:           time.Now().UTC(),
+		SyncedBy:           sides[0].splitwiseID,
+	}
+
+	for i, side := range sides {
+		data := side.data(&metadata)
+		data.SplitwiseUserID = side.splitwiseID
+		data.LMAssetID = side.lmConfig.SplitwiseAccountAssetID
+
+		planned := PlannedLMChange{User: side.name, SplitwiseUserID: side.splitwiseID, Action: PlanInsert}
+		transaction, err := TransformSWToLMTransaction(expense, side.splitwiseID, side.lmConfig, e.transactionConfig())
+		switch {
+		case errors.Is(err, ErrNothingOwed):
+			planned.Action = PlanSkip
+		case err != nil:
+			planned.Error = err.Error()
+		case existing[i].err != nil:
+			// Sync won't insert blind either
+			planned.Error = existing[i].err.Error()
+		default:
+			if found, ok := existing[i].byExternalID[transaction.ExternalID]; ok {
+				planned.LMTransactionID = found.ID
+				data.LMTransactionID = found.ID
+				planned.Action = PlanRecover
+				if !matchesTransaction(found, transaction) {
+					planned.Action = PlanUpdate
+					transaction.Status = ""
+				}
+			}
+			planned.RequestBody, _ = json.Marshal(transaction)
+			data.LMRequestBody = string(planned.RequestBody)
+		}
+		change.Users = append(change.Users, planned)
+	}
+
+	change.Comment, _ = e.commentOptions().EncodeSyncComment(metadata)
+	return change
+}
+
+func (e *Engine) planUpdate(sides []userSide, action models.UpdateAction) PlannedChange {
+	change := PlannedChange{
+		ExpenseID:     action.ExpenseID,
+		Description:   action.Expense.Description,
+		ChangedFields: action.ChangedFields,
+	}
+
+	snapshot, err := detector.NewExpenseSnapshot(action.Expense)
+	if err != nil {
+		change.Error = err.Error()
+		return change
+	}
+
+	metadata := action.SyncData
+	for _, side := range sides {
+		data := side.data(&metadata)
+		planned := PlannedLMChange{
+			User:            side.name,
+			SplitwiseUserID: side.splitwiseID,
+			LMTransactionID: data.LMTransactionID,
+		}
+
+		transaction, ok, err := e.updatedTransaction(side, *data, action.Expense)
+		switch {
+		case err != nil:
+			planned.Error = err.Error()
+		case !ok:
+			planned.Action = PlanSkip
+		case data.LMTransactionID <= 0:
+			planned.Action = PlanInsert
+		case transaction.Amount == models.FormatCents(0):
+			planned.Action = PlanZero
+		default:
+			planned.Action = PlanUpdate
+		}
+		if ok {
+			if data.LMTransactionID > 0 {
+				// as in Sync, updates leave the status alone
+				transaction.Status = ""
+			}
+			planned.RequestBody, _ = json.Marshal(transaction)
+			data.LMRequestBody = string(planned.RequestBody)
+			data.Error = ""
+		}
+		change.Users = append(change.Users, planned)
+	}
+
+	metadata.SnapshotHash = detector.HashSnapshot(snapshot)
+	metadata.Snapshot = &snapshot
+	metadata.SyncedAt = time.Now().UTC()
+	metadata.SyncedBy = sides[0].splitwiseID
+
+	change.Comment, _ = e.commentOptions().EncodeSyncComment(metadata)
+	return change
+}
+
+func (e *Engine) planDelete(sides []userSide, action models.DeleteAction) PlannedChange {
+	change := PlannedChange{ExpenseID: action.ExpenseID}
+	if action.SyncData.Snapshot != nil {
+		change.Description = action.SyncData.Snapshot.Description
+	}
+
+	for _, side := range sides {
+		data := side.data(&action.SyncData)
+		planned := PlannedLMChange{
+			User:            side.name,
+			SplitwiseUserID: side.splitwiseID,
+			LMTransactionID: data.LMTransactionID,
+			Action:          PlanSkip,
+		}
+
+		switch {
+		case data.LMTransactionID <= 0:
+		case e.config.DeleteMode == config.DeleteModeDelete:
+			planned.Action = PlanDelete
+		default:
+			planned.Action = PlanZero
+			transaction, err := e.deletedTransaction(*data)
+			if err != nil {
+				planned.Error = err.Error()
+				break
+			}
+			planned.RequestBody, _ = json.Marshal(transaction)
+		}
+		change.Users = append(change.Users, planned)
+	}
+
+	change.Comment, _ = e.commentOptions().EncodeDeletionComment(models.DeletionMetadata{
+		SplitwiseExpenseID: action.ExpenseID,
+		DeletedFromLMAt:    time.Now().UTC(),
+		DeletedBy:          sides[0].splitwiseID,
+		Mode:               e.config.DeleteMode,
+		UserA:              action.SyncData.UserA,
+		UserB:              action.SyncData.UserB,
+	})
+	return change
+}
+
+// WriteText prints the plan for a person to review.
+func (p Plan) WriteText(w io.Writer) error {
+	var b strings.Builder
+
+	mode := ""
+	if p.TestMode {
+		mode = " (test mode)"
+	}
+	fmt.Fprintf(&b, "Plan%s: %d to create, %d to update, %d to delete\n", mode, len(p.Creates), len(p.Updates), len(p.Deletes))
+	writeChanges(&b, "Create", p.Creates)
+	writeChanges(&b, "Update", p.Updates)
+	writeChanges(&b, "Delete", p.Deletes)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeChanges(b *strings.Builder, title string, changes []PlannedChange) {
+	for _, change := range changes {
+		fmt.Fprintf(b, "\n%s expense %d %q\n", title, change.ExpenseID, change.Description)
+		if len(change.ChangedFields) > 0 {
+			fmt.Fprintf(b, "  changed: %s\n", strings.Join(change.ChangedFields, ", "))
+		}
+		if change.Error != "" {
+			fmt.Fprintf(b, "  error: %s\n", change.Error)
+			continue
+		}
+
+		for _, user := range change.Users {
+			fmt.Fprintf(b, "  %s (%d): %s", user.User, user.SplitwiseUserID, user.Action)
+			if user.LMTransactionID > 0 {
+				fmt.Fprintf(b, " transaction %d", user.LMTransactionID)
+			}
+			b.WriteString("\n")
+			if user.Error != "" {
+				fmt.Fprintf(b, "    error: %s\n", user.Error)
+			}
+			if len(user.RequestBody) > 0 {
+				fmt.Fprintf(b, "    request: %s\n", user.RequestBody)
+			}
+		}
+
+		if change.Comment != "" {
+			fmt.Fprintf(b, "  splitwise comment:\n    %s\n", strings.ReplaceAll(change.Comment, "\n", "\n    "))
+		}
+	}
+}
+
+// WriteJSON prints the plan as indented JSON for tooling.
+func (p Plan) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(p)
+}
@@ -0,0 +1,217 @@
+package syncengine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jasmineyas/splitwise-lunchmoney/config"
+	"github.com/jasmineyas/splitwise-lunchmoney/detector"
+	"github.com/jasmineyas/splitwise-lunchmoney/models"
+)
+
+// testSides mirrors Engine.sides without a Splitwise lookup; planning never
+// touches the Lunch Money clients.
+func testSides() []userSide {
+	return []userSide{
+		{
+			name:        "user A",
+			splitwiseID: jasmineID,
+			lmConfig:    config.LunchMoneyUserConfig{SplitwiseAccountAssetID: 111},
+			data:        func(m *models.SyncMetadata) *models.UserSyncData { return &m.UserA },
+		},
+		{
+			name:        "user B",
+			splitwiseID: wesleyID,
+			lmConfig:    config.LunchMoneyUserConfig{SplitwiseAccountAssetID: 222},
+			data:        func(m *models.SyncMetadata) *models.UserSyncData { return &m.UserB },
+		},
+	}
+}
+
+func TestPlanCreate(t *testing.T) {
+	engine := &Engine{config: &config.Config{DeleteMode: config.DeleteModeZero}}
+	expense := models.SplitwiseExpense{
+		ID:          4096669090,
+		Description: "save on foods",
+		Cost:        "35.72",
+		Date:        time.Date(2025, 10, 11, 6, 58, 32, 0, time.UTC),
+		Currency:    "CAD",
+		Repayments:  []models.Repayment{{From: jasmineID, To: wesleyID, Amount: "17.86"}},
+		Users:       testUsers,
+	}
+
+	change := engine.planCreate(testSides(), make([]existingLookup, 2), expense)
+
+	if change.Error != "" {
+		t.Fatalf("planCreate() error = %s", change.Error)
+	}
+	if len(change.Users) != 2 {
+		t.Fatalf("planCreate() planned %d users, want 2", len(change.Users))
+	}
+
+	wantAmounts := []string{"-17.86", "17.86"}
+	for i, user := range change.Users {
+		if user.Action != PlanInsert {
+			t.Errorf("%s action = %s, want %s", user.User, user.Action, PlanInsert)
+		}
+
+		var transaction models.LunchMoneyTransaction
+		if err := json.Unmarshal(user.RequestBody, &transaction); err != nil {
+			t.Fatalf("%s request body: %v", user.User, err)
+		}
+		if transaction.Amount != wantAmounts[i] {
+			t.Errorf("%s amount = %s, want %s", user.User, transaction.Amount, wantAmounts[i])
+		}
+	}
+
+	metadata, err := detector.ParseSyncComment(change.Comment)
+	if err != nil {
+		t.Fatalf("planned comment doesn't parse: %v", err)
+	}
+	if metadata.SplitwiseExpenseID != expense.ID {
+		t.Errorf("planned comment expense ID = %d, want %d", metadata.SplitwiseExpenseID, expense.ID)
+	}
+	if metadata.UserB.LMAssetID != 222 {
+		t.Errorf("planned comment user B asset = %d, want 222", metadata.UserB.LMAssetID)
+	}
+}
+
+func TestPlanCreateLooksUpExisting(t *testing.T) {
+	tests := []struct {
+		name       string
+		amount     string // of user A's transaction left by an earlier run, "" for none
+		lookupErr  error
+		wantAction string
+		wantError  bool
+	}{
+		{name: "nothing in Lunch Money", wantAction: PlanInsert},
+		{name: "matching transaction", amount: "-17.86", wantAction: PlanRecover},
+		{name: "stale transaction", amount: "-10.00", wantAction: PlanUpdate},
+		{name: "lookup fails", lookupErr: errors.New("connection reset"), wantAction: PlanInsert, wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(config.DeleteModeZero)
+			env.engine.config.TestMode = true
+			expense := groceries()
+
+			var lmID int64
+			if tt.amount != "" {
+				earlier, err := TransformSWToLMTransaction(expense, jasmineID, env.engine.config.UserALunchMoney, env.engine.transactionConfig())
+				if err != nil {
+					t.Fatalf("TransformSWToLMTransaction() error = %v", err)
+				}
+				earlier.Amount = tt.amount
+				ids, err := env.lmA.AddTransactionsContext(context.Background(), []models.LunchMoneyTransaction{earlier})
+				if err != nil {
+					t.Fatalf("seeding transaction: %v", err)
+				}
+				lmID, _ = strconv.ParseInt(ids[0], 10, 64)
+			}
+			seedCalls := len(env.lmA.Calls())
+			env.lmA.Errs["GetTransactions"] = tt.lookupErr
+
+			plan, err := env.engine.Plan(context.Background(), []models.SplitwiseExpense{expense}, nil, nil)
+			if err != nil {
+				t.Fatalf("Plan() error = %v", err)
+			}
+			if !plan.TestMode {
+				t.Error("plan doesn't report test mode")
+			}
+
+			userA := plan.Creates[0].Users[0]
+			if userA.Action != tt.wantAction || userA.LMTransactionID != lmID {
+				t.Errorf("user A = %s transaction %d, want %s transaction %d", userA.Action, userA.LMTransactionID, tt.wantAction, lmID)
+			}
+			if (userA.Error != "") != tt.wantError {
+				t.Errorf("user A error = %q, want error %v", userA.Error, tt.wantError)
+			}
+			for _, call := range env.lmA.Calls()[seedCalls:] {
+				if !strings.HasPrefix(call, "GetTransactions") {
+					t.Errorf("Plan() called %s, want only reads", call)
+				}
+			}
+		})
+	}
+}
+
+func TestPlanDelete(t *testing.T) {
+	requestBody := `{"date":"2025-10-11","amount":"-17.86","payee":"Wesley Finck","currency":"cad","notes":"Expense ID: 1","status":"uncleared","tags":["Splitwise-lunchmoney-sync"]}`
+	action := models.DeleteAction{
+		ExpenseID: 1,
+		SyncData: models.SyncMetadata{
+			SplitwiseExpenseID: 1,
+			UserA:              models.UserSyncData{LMTransactionID: 12345, LMRequestBody: requestBody},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		deleteMode string
+		wantAction string
+		wantBody   bool
+	}{
+		{name: "zero mode", deleteMode: config.DeleteModeZero, wantAction: PlanZero, wantBody: true},
+		{name: "delete mode", deleteMode: config.DeleteModeDelete, wantAction: PlanDelete},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := &Engine{config: &config.Config{DeleteMode: tt.deleteMode}}
+
+			change := engine.planDelete(testSides(), action)
+
+			if change.Users[0].Action != tt.wantAction {
+				t.Errorf("user A action = %s, want %s", change.Users[0].Action, tt.wantAction)
+			}
+			if (len(change.Users[0].RequestBody) > 0) != tt.wantBody {
+				t.Errorf("user A request body = %s, want body %v", change.Users[0].RequestBody, tt.wantBody)
+			}
+			if change.Users[1].Action != PlanSkip {
+				t.Errorf("user B action = %s, want %s", change.Users[1].Action, PlanSkip)
+			}
+			if _, err := detector.ParseDeletionComment(change.Comment); err != nil {
+				t.Errorf("planned deletion comment doesn't parse: %v", err)
+			}
+		})
+	}
+}
+
+func TestPlanWriteText(t *testing.T) {
+	plan := Plan{
+		Creates: []PlannedChange{{
+			ExpenseID:   4096669090,
+			Description: "save on foods",
+			Users: []PlannedLMChange{
+				{User: "user A", SplitwiseUserID: jasmineID, Action: PlanInsert, RequestBody: json.RawMessage(`{"amount":"-17.86"}`)},
+				{User: "user B", SplitwiseUserID: wesleyID, Action: PlanSkip},
+			},
+			Comment: "Synced-to-LM v1\n{}",
+		}},
+	}
+
+	var buf bytes.Buffer
+	if err := plan.WriteText(&buf); err != nil {
+		t.Fatalf("WriteText() error = %v", err)
+	}
+
+	for _, want := range []string{
+		"Plan: 1 to create, 0 to update, 0 to delete",
+		`Create expense 4096669090 "save on foods"`,
+		`user A (9792490): insert`,
+		`request: {"amount":"-17.86"}`,
+		`user B (50086667): skip`,
+		"    Synced-to-LM v1\n    {}",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("WriteText() output missing %q:\n%s", want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,494 @@
+package syncengine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jasmineyas/splitwise-lunchmoney/apierror"
+	"github.com/jasmineyas/splitwise-lunchmoney/config"
+	"github.com/jasmineyas/splitwise-lunchmoney/detector"
+	"github.com/jasmineyas/splitwise-lunchmoney/lunchmoney"
+	"github.com/jasmineyas/splitwise-lunchmoney/models"
+	"github.com/jasmineyas/splitwise-lunchmoney/syncEngine/fake"
+)
+
+var (
+	_ SplitwiseAPI  = (*fake.Splitwise)(nil)
+	_ LunchMoneyAPI = (*fake.LunchMoney)(nil)
+)
+
+// testEnv is an engine wired to fakes, with user A as jasmineID.
+type testEnv struct {
+	engine *Engine
+	sw     *fake.Splitwise
+	lmA    *fake.LunchMoney
+	lmB    *fake.LunchMoney
+}
+
+func newTestEnv(deleteMode string) testEnv {
+	env := testEnv{
+		sw:  fake.NewSplitwise(jasmineID),
+		lmA: fake.NewLunchMoney(),
+		lmB: fake.NewLunchMoney(),
+	}
+	cfg := &config.Config{
+		UserBSplitwiseID: wesleyID,
+		UserALunchMoney:  config.LunchMoneyUserConfig{SplitwiseAccountAssetID: 111},
+		UserBLunchMoney:  config.LunchMoneyUserConfig{SplitwiseAccountAssetID: 222},
+		DeleteMode:       deleteMode,
+	}
+	env.engine = New(env.sw, env.lmA, env.lmB, cfg)
+	return env
+}
+
+// detect runs change detection against the comments the engine posted.
+func (env testEnv) detect(t *testing.T, expenses ...models.SplitwiseExpense) ([]models.SplitwiseExpense, []models.UpdateAction, []models.DeleteAction) {
+	t.Helper()
+	toCreate, toUpdate, toDelete, err := detector.DetectChanges(expenses, env.sw.Comments, detector.Options{SyncUserID: jasmineID})
+	if err != nil {
+		t.Fatalf("DetectChanges() error = %v", err)
+	}
+	return toCreate, toUpdate, toDelete
+}
+
+// syncState is the latest state recorded on the expense.
+func (env testEnv) syncState(t *testing.T, expenseID int64) models.ExpenseState {
+	t.Helper()
+	expenseState, err := detector.StateFromComments(env.sw.CommentsOn(expenseID), detector.Options{SyncUserID: jasmineID})
+	if err != nil {
+		t.Fatalf("StateFromComments() error = %v", err)
+	}
+	return expenseState
+}
+
+func groceries() models.SplitwiseExpense {
+	return models.SplitwiseExpense{
+		ID:          4096669090,
+		Description: "save on foods",
+		Cost:        "35.72",
+		Date:        time.Date(2025, 10, 11, 6, 58, 32, 0, time.UTC),
+		Currency:    "CAD",
+		Repayments:  []models.Repayment{{From: jasmineID, To: wesleyID, Amount: "17.86"}},
+		Users:       testUsers,
+	}
+}
+
+func TestSyncCreate(t *testing.T) {
+	env := newTestEnv(config.DeleteModeZero)
+	expense := groceries()
+
+	result, err := env.engine.Sync(context.Background(), []models.SplitwiseExpense{expense}, nil, nil)
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if want := (Result{Created: 1}); !reflect.DeepEqual(result, want) {
+		t.Errorf("Sync() result = %+v, want %+v", result, want)
+	}
+
+	synced := env.syncState(t, expense.ID).Sync
+	if synced == nil {
+		t.Fatal("no sync comment posted")
+	}
+
+	tests := []struct {
+		name       string
+		lm         *fake.LunchMoney
+		data       models.UserSyncData
+		wantAsset  int64
+		wantAmount string
+	}{
+		{name: "user A", lm: env.lmA, data: synced.UserA, wantAsset: 111, wantAmount: "-17.86"},
+		{name: "user B", lm: env.lmB, data: synced.UserB, wantAsset: 222, wantAmount: "17.86"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transaction, ok := tt.lm.Transaction(tt.data.LMTransactionID)
+			if !ok {
+				t.Fatalf("transaction %d recorded in the comment isn't in Lunch Money", tt.data.LMTransactionID)
+			}
+			if transaction.AssetID != tt.wantAsset || transaction.Amount != tt.wantAmount {
+				t.Errorf("transaction = asset %d amount %s, want asset %d amount %s", transaction.AssetID, transaction.Amount, tt.wantAsset, tt.wantAmount)
+			}
+			if transaction.ExternalID != "splitwise-4096669090" {
+				t.Errorf("transaction external ID = %q, want splitwise-4096669090", transaction.ExternalID)
+			}
+		})
+	}
+
+	if toCreate, toUpdate, toDelete := env.detect(t, expense); len(toCreate)+len(toUpdate)+len(toDelete) != 0 {
+		t.Errorf("after sync, detection found %d/%d/%d changes, want none", len(toCreate), len(toUpdate), len(toDelete))
+	}
+}
+
+func TestSyncCreatePartialFailureIsRetried(t *testing.T) {
+	env := newTestEnv(config.DeleteModeZero)
+	expense := groceries()
+	env.lmB.Errs["AddTransactions"] = errors.New("connection reset")
+
+	result, err := env.engine.Sync(context.Background(), []models.SplitwiseExpense{expense}, nil, nil)
+	if err == nil {
+		t.Error("Sync() error = nil, want user B's failure")
+	}
+	// user A's transaction exists, so the expense is recorded as created,
+	// and left unfinished for user B
+	if want := (Result{Created: 1, Unfinished: []int64{expense.ID}}); !reflect.DeepEqual(result, want) {
+		t.Errorf("Sync() result = %+v, want %+v", result, want)
+	}
+	if synced := env.syncState(t, expense.ID).Sync; synced == nil || synced.UserB.Error == "" {
+		t.Fatalf("sync comment = %+v, want user B's error recorded", synced)
+	}
+
+	delete(env.lmB.Errs, "AddTransactions")
+	_, toUpdate, _ := env.detect(t, expense)
+	if len(toUpdate) != 1 || !slices.Contains(toUpdate[0].ChangedFields, "retry") {
+		t.Fatalf("detection = %+v, want one retry", toUpdate)
+	}
+
+	result, err = env.engine.Sync(context.Background(), nil, toUpdate, nil)
+	if err != nil {
+		t.Fatalf("retry Sync() error = %v", err)
+	}
+	if want := (Result{Updated: 1}); !reflect.DeepEqual(result, want) {
+		t.Errorf("retry Sync() result = %+v, want %+v", result, want)
+	}
+	if len(env.lmA.Transactions) != 1 || len(env.lmB.Transactions) != 1 {
+		t.Errorf("after retry, user A has %d transactions and user B %d, want 1 each", len(env.lmA.Transactions), len(env.lmB.Transactions))
+	}
+	calls := env.lmA.Calls()
+	if inserts := len(slices.DeleteFunc(slices.Clone(calls), func(call string) bool { return call != "AddTransactions(1)" })); inserts != 1 {
+		t.Errorf("user A was inserted %d times, want 1: %v", inserts, calls)
+	}
+}
+
+func TestSyncRetryRecoversLandedInsert(t *testing.T) {
+	env := newTestEnv(config.DeleteModeZero)
+	expense := groceries()
+	env.lmB.Errs["AddTransactions"] = errors.New("timeout awaiting response headers")
+
+	if _, err := env.engine.Sync(context.Background(), []models.SplitwiseExpense{expense}, nil, nil); err == nil {
+		t.Fatal("Sync() error = nil, want user B's failure")
+	}
+
+	// the insert reached Lunch Money even though the response was lost
+	delete(env.lmB.Errs, "AddTransactions")
+	landed, err := TransformSWToLMTransaction(expense, wesleyID, env.engine.config.UserBLunchMoney, env.engine.transactionConfig())
+	if err != nil {
+		t.Fatalf("TransformSWToLMTransaction() error = %v", err)
+	}
+	lmID := env.lmB.Put(landed)
+
+	_, toUpdate, _ := env.detect(t, expense)
+	if len(toUpdate) != 1 {
+		t.Fatalf("detection found %d updates, want the retry", len(toUpdate))
+	}
+	result, err := env.engine.Sync(context.Background(), nil, toUpdate, nil)
+	if err != nil {
+		t.Fatalf("retry Sync() error = %v", err)
+	}
+	if want := (Result{Updated: 1}); !reflect.DeepEqual(result, want) {
+		t.Errorf("retry Sync() result = %+v, want %+v", result, want)
+	}
+
+	if len(env.lmB.Transactions) != 1 {
+		t.Errorf("user B has %d transactions, want the landed one only: %v", len(env.lmB.Transactions), env.lmB.Calls())
+	}
+	data := env.syncState(t, expense.ID).Sync.UserB
+	if data.LMTransactionID != lmID || data.Error != "" {
+		t.Errorf("user B = transaction %d error %q, want transaction %d and no error", data.LMTransactionID, data.Error, lmID)
+	}
+}
+
+func TestSyncCreateCommentFailureIsRecovered(t *testing.T) {
+	env := newTestEnv(config.DeleteModeZero)
+	expense := groceries()
+	env.sw.Errs["AddCommentToExpense"] = errors.New("connection reset")
+
+	result, err := env.engine.Sync(context.Background(), []models.SplitwiseExpense{expense}, nil, nil)
+	if err == nil {
+		t.Fatal("Sync() error = nil, want the comment failure")
+	}
+	if want := (Result{Failed: 1, Unfinished: []int64{expense.ID}}); !reflect.DeepEqual(result, want) {
+		t.Errorf("Sync() result = %+v, want %+v", result, want)
+	}
+
+	// a restarted process keeps nothing in memory; the transactions are
+	// found again by external ID
+	delete(env.sw.Errs, "AddCommentToExpense")
+	engine := New(env.sw, env.lmA, env.lmB, env.engine.config)
+	toCreate, _, _ := env.detect(t, expense)
+	if len(toCreate) != 1 {
+		t.Fatalf("detection found %d creates, want the uncommented expense", len(toCreate))
+	}
+	if _, err := engine.Sync(context.Background(), toCreate, nil, nil); err != nil {
+		t.Fatalf("retry Sync() error = %v", err)
+	}
+
+	synced := env.syncState(t, expense.ID).Sync
+	tests := []struct {
+		name string
+		lm   *fake.LunchMoney
+		data models.UserSyncData
+	}{
+		{name: "user A", lm: env.lmA, data: synced.UserA},
+		{name: "user B", lm: env.lmB, data: synced.UserB},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if len(tt.lm.Transactions) != 1 {
+				t.Fatalf("Lunch Money has %d transactions, want 1", len(tt.lm.Transactions))
+			}
+			if _, ok := tt.lm.Transaction(tt.data.LMTransactionID); !ok {
+				t.Errorf("recorded transaction %d isn't in Lunch Money", tt.data.LMTransactionID)
+			}
+			var fetched models.LunchMoneyTransaction
+			if err := json.Unmarshal([]byte(tt.data.LMResponseBody), &fetched); err != nil || fetched.ID != tt.data.LMTransactionID {
+				t.Errorf("LMResponseBody = %s, want the transaction read from Lunch Money", tt.data.LMResponseBody)
+			}
+		})
+	}
+}
+
+func TestSyncCreateRecoversExisting(t *testing.T) {
+	tests := []struct {
+		name       string
+		amount     string
+		wantUpdate bool
+	}{
+		{name: "matching transaction is only recorded", amount: "-17.86"},
+		// inserted by a run that died before commenting, then the expense was edited
+		{name: "stale transaction is updated", amount: "-10.00", wantUpdate: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(config.DeleteModeZero)
+			expense := groceries()
+
+			earlier, err := TransformSWToLMTransaction(expense, jasmineID, env.engine.config.UserALunchMoney, env.engine.transactionConfig())
+			if err != nil {
+				t.Fatalf("TransformSWToLMTransaction() error = %v", err)
+			}
+			earlier.Amount = tt.amount
+			earlier.Status = config.StatusCleared
+			ids, err := env.lmA.AddTransactionsContext(context.Background(), []models.LunchMoneyTransaction{earlier})
+			if err != nil {
+				t.Fatalf("seeding transaction: %v", err)
+			}
+			lmID, _ := strconv.ParseInt(ids[0], 10, 64)
+
+			if _, err := env.engine.Sync(context.Background(), []models.SplitwiseExpense{expense}, nil, nil); err != nil {
+				t.Fatalf("Sync() error = %v", err)
+			}
+
+			calls := env.lmA.Calls()
+			if slices.Contains(calls[1:], "AddTransactions(1)") {
+				t.Errorf("user A was inserted again: %v", calls)
+			}
+			if updated := slices.Contains(calls, fmt.Sprintf("UpdateTransaction(%d)", lmID)); updated != tt.wantUpdate {
+				t.Errorf("updated = %v, want %v: %v", updated, tt.wantUpdate, calls)
+			}
+
+			transaction, _ := env.lmA.Transaction(lmID)
+			if transaction.Amount != "-17.86" || transaction.Status != config.StatusCleared {
+				t.Errorf("transaction = amount %s status %s, want -17.86 still cleared", transaction.Amount, transaction.Status)
+			}
+
+			data := env.syncState(t, expense.ID).Sync.UserA
+			if data.LMTransactionID != lmID {
+				t.Errorf("recorded transaction = %d, want %d", data.LMTransactionID, lmID)
+			}
+			var fetched models.LunchMoneyTransaction
+			if err := json.Unmarshal([]byte(data.LMResponseBody), &fetched); err != nil || fetched.ID != lmID || fetched.Amount != tt.amount {
+				t.Errorf("LMResponseBody = %s, want the transaction read from Lunch Money", data.LMResponseBody)
+			}
+		})
+	}
+}
+
+func TestSyncUpdate(t *testing.T) {
+	env := newTestEnv(config.DeleteModeZero)
+	expense := groceries()
+	if _, err := env.engine.Sync(context.Background(), []models.SplitwiseExpense{expense}, nil, nil); err != nil {
+		t.Fatalf("create Sync() error = %v", err)
+	}
+
+	expense.Cost = "50.00"
+	expense.Repayments = []models.Repayment{{From: jasmineID, To: wesleyID, Amount: "25.00"}}
+	_, toUpdate, _ := env.detect(t, expense)
+	if len(toUpdate) != 1 {
+		t.Fatalf("detection found %d updates, want 1", len(toUpdate))
+	}
+
+	result, err := env.engine.Sync(context.Background(), nil, toUpdate, nil)
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if want := (Result{Updated: 1}); !reflect.DeepEqual(result, want) {
+		t.Errorf("Sync() result = %+v, want %+v", result, want)
+	}
+
+	synced := env.syncState(t, expense.ID).Sync
+	transaction, _ := env.lmA.Transaction(synced.UserA.LMTransactionID)
+	if transaction.Amount != "-25.00" {
+		t.Errorf("user A amount = %s, want -25.00", transaction.Amount)
+	}
+	if len(env.lmA.Transactions) != 1 {
+		t.Errorf("user A has %d transactions, want the original one updated", len(env.lmA.Transactions))
+	}
+}
+
+func TestSyncUpdateKeepsClearedStatus(t *testing.T) {
+	env := newTestEnv(config.DeleteModeZero)
+	expense := groceries()
+	if _, err := env.engine.Sync(context.Background(), []models.SplitwiseExpense{expense}, nil, nil); err != nil {
+		t.Fatalf("create Sync() error = %v", err)
+	}
+
+	// user A reconciles the transaction in Lunch Money
+	lmID := env.syncState(t, expense.ID).Sync.UserA.LMTransactionID
+	transaction, _ := env.lmA.Transaction(lmID)
+	if transaction.Status != config.StatusUncleared {
+		t.Fatalf("inserted status = %q, want %q", transaction.Status, config.StatusUncleared)
+	}
+	transaction.Status = config.StatusCleared
+	env.lmA.Transactions[lmID] = transaction
+
+	expense.Description = "save on foods (edited)"
+	_, toUpdate, _ := env.detect(t, expense)
+	if _, err := env.engine.Sync(context.Background(), nil, toUpdate, nil); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	transaction, _ = env.lmA.Transaction(lmID)
+	if transaction.Status != config.StatusCleared {
+		t.Errorf("status after update = %q, want %q", transaction.Status, config.StatusCleared)
+	}
+}
+
+func TestSyncDelete(t *testing.T) {
+	tests := []struct {
+		name       string
+		deleteMode string
+		wantKept   bool
+	}{
+		{name: "zero mode", deleteMode: config.DeleteModeZero, wantKept: true},
+		{name: "delete mode", deleteMode: config.DeleteModeDelete},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(tt.deleteMode)
+			expense := groceries()
+			if _, err := env.engine.Sync(context.Background(), []models.SplitwiseExpense{expense}, nil, nil); err != nil {
+				t.Fatalf("create Sync() error = %v", err)
+			}
+			lmID := env.syncState(t, expense.ID).Sync.UserA.LMTransactionID
+
+			deletedAt := time.Now()
+			expense.DeletedAt = &deletedAt
+			_, _, toDelete := env.detect(t, expense)
+
+			result, err := env.engine.Sync(context.Background(), nil, nil, toDelete)
+			if err != nil {
+				t.Fatalf("Sync() error = %v", err)
+			}
+			if want := (Result{Deleted: 1}); !reflect.DeepEqual(result, want) {
+				t.Errorf("Sync() result = %+v, want %+v", result, want)
+			}
+
+			transaction, kept := env.lmA.Transaction(lmID)
+			if kept != tt.wantKept {
+				t.Errorf("transaction kept = %v, want %v", kept, tt.wantKept)
+			}
+			if kept && transaction.Amount != models.FormatCents(0) {
+				t.Errorf("zeroed amount = %s, want %s", transaction.Amount, models.FormatCents(0))
+			}
+			if env.syncState(t, expense.ID).Deletion == nil {
+				t.Error("no deletion comment posted")
+			}
+			if toCreate, toUpdate, toDelete := env.detect(t, expense); len(toCreate)+len(toUpdate)+len(toDelete) != 0 {
+				t.Errorf("after delete, detection found %d/%d/%d changes, want none", len(toCreate), len(toUpdate), len(toDelete))
+			}
+		})
+	}
+}
+
+func TestSyncDeleteZeroKeepsNotesWithinLimit(t *testing.T) {
+	env := newTestEnv(config.DeleteModeZero)
+	expense := groceries()
+	expense.Description = strings.Repeat("save on foods ", 30)
+	if _, err := env.engine.Sync(context.Background(), []models.SplitwiseExpense{expense}, nil, nil); err != nil {
+		t.Fatalf("create Sync() error = %v", err)
+	}
+	lmID := env.syncState(t, expense.ID).Sync.UserA.LMTransactionID
+	if created, _ := env.lmA.Transaction(lmID); utf8.RuneCountInString(created.Notes) != lunchmoney.MaxNotesLength {
+		t.Fatalf("created notes are %d characters, want them cut to %d", utf8.RuneCountInString(created.Notes), lunchmoney.MaxNotesLength)
+	}
+
+	deletedAt := time.Now()
+	expense.DeletedAt = &deletedAt
+	_, _, toDelete := env.detect(t, expense)
+	if _, err := env.engine.Sync(context.Background(), nil, nil, toDelete); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	transaction, _ := env.lmA.Transaction(lmID)
+	if n := utf8.RuneCountInString(transaction.Notes); n > lunchmoney.MaxNotesLength {
+		t.Errorf("zeroed notes are %d characters, want at most %d", n, lunchmoney.MaxNotesLength)
+	}
+	if !strings.HasPrefix(transaction.Notes, "Deleted in Splitwise\n") {
+		t.Errorf("zeroed notes = %q, want the deletion prefix kept", transaction.Notes)
+	}
+}
+
+func TestSyncDeleteAlreadyGone(t *testing.T) {
+	env := newTestEnv(config.DeleteModeDelete)
+	action := models.DeleteAction{
+		ExpenseID: 1,
+		SyncData: models.SyncMetadata{
+			SplitwiseExpenseID: 1,
+			UserA:              models.UserSyncData{LMTransactionID: 999},
+		},
+	}
+
+	result, err := env.engine.Sync(context.Background(), nil, nil, []models.DeleteAction{action})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if want := (Result{Deleted: 1}); !reflect.DeepEqual(result, want) {
+		t.Errorf("Sync() result = %+v, want %+v", result, want)
+	}
+}
+
+func TestSyncAbortsOnRejectedToken(t *testing.T) {
+	env := newTestEnv(config.DeleteModeDelete)
+	env.lmA.Errs["AddTransactions"] = &apierror.Error{Service: apierror.LunchMoney, StatusCode: http.StatusUnauthorized}
+	deletes := []models.DeleteAction{
+		{ExpenseID: 1, SyncData: models.SyncMetadata{SplitwiseExpenseID: 1, UserA: models.UserSyncData{LMTransactionID: 1}}},
+		{ExpenseID: 2, SyncData: models.SyncMetadata{SplitwiseExpenseID: 2, UserA: models.UserSyncData{LMTransactionID: 2}}},
+	}
+
+	result, err := env.engine.Sync(context.Background(), []models.SplitwiseExpense{groceries()}, nil, deletes)
+
+	if !errors.Is(err, ErrTokenRejected) {
+		t.Errorf("Sync() error = %v, want %v", err, ErrTokenRejected)
+	}
+	// user B's insert was in the same batch and still gets recorded
+	want := Result{Created: 1, Interrupted: 2, Unfinished: []int64{groceries().ID, 1, 2}}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("Sync() result = %+v, want %+v", result, want)
+	}
+	if calls := env.lmA.Calls(); slices.Contains(calls, "DeleteTransaction(1)") {
+		t.Errorf("deletes ran after the token was rejected: %v", calls)
+	}
+}
@@ -0,0 +1,138 @@
+package syncengine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jasmineyas/splitwise-lunchmoney/config"
+	"github.com/jasmineyas/splitwise-lunchmoney/models"
+)
+
+const paymentCreationMethod = "payment"
+
+// ErrNothingOwed is returned when the expense leaves no balance between the
+// perspective user and anyone else, e.g. they are not part of any repayment.
+var ErrNothingOwed = errors.New("expense has no balance for user")
+
+// TransformSWToLMTransaction builds the Lunch Money transaction for one
+// Splitwise expense as seen by userID. The four cases from IMPLEMENTATION.md:
+//
+//  1. user owes money (from in repayments)          -> negative amount
+//  2. others owe user (to in repayments)            -> positive amount
+//  3. others pay user back (payment, from)          -> negative amount
+//  4. user pays others back (payment, to)           -> positive amount
+//
+// Splitwise records a payment as an expense the sender paid and the receiver
+// owes, so its repayment runs from the receiver to the sender. The same sign
+// rule then makes a settle-up cancel the balance of the expenses it pays off.
+//
+// Amounts assume debit_as_negative, which AddTransactions always sends. Status,
+// tags and notes come from txCfg.
+func TransformSWToLMTransaction(expense models.SplitwiseExpense, userID int64, userCfg config.LunchMoneyUserConfig, txCfg config.TransactionConfig) (models.LunchMoneyTransaction, error) {
+	var owedByUser, owedToUser int64
+	var creditors, debtors []int64
+
+	for i, repayment := range expense.Repayments {
+		cents, err := models.ParseCents(repayment.Amount)
+		if err != nil {
+			return models.LunchMoneyTransaction{}, fmt.Errorf("expense %d repayment[%d]: %w", expense.ID, i, err)
+		}
+
+		switch userID {
+		case repayment.From:
+			owedByUser += cents
+			creditors = append(creditors, repayment.To)
+		case repayment.To:
+			owedToUser += cents
+			debtors = append(debtors, repayment.From)
+		}
+	}
+
+	net := owedToUser - owedByUser
+	if net == 0 {
+		return models.LunchMoneyTransaction{}, fmt.Errorf("expense %d, user %d: %w", expense.ID, userID, ErrNothingOwed)
+	}
+
+	counterparties := debtors
+	if net < 0 {
+		counterparties = creditors
+	}
+
+	transaction := models.LunchMoneyTransaction{
+		Date:     expense.Date.Format("2006-01-02"),
+		Payee:    payeeNames(expense, counterparties),
+		Currency: strings.ToLower(expense.Currency),
+		AssetID:  userCfg.SplitwiseAccountAssetID,
+		Status:   txCfg.Status,
+	}
+
+	notes := config.NotesData{
+		ExpenseID:   expense.ID,
+		Description: expense.Description,
+		Amount:      models.FormatCents(max(net, -net)),
+		Currency:    transaction.Currency,
+		OwedToYou:   net > 0,
+	}
+	if expense.Receipt.Original != nil {
+		notes.Receipt = *expense.Receipt.Original
+	}
+
+	transaction.Amount = models.FormatCents(net)
+	if isPayment(expense) {
+		notes.Payment = true
+		transaction.ExternalID = txCfg.ExternalID(expense.ID, true)
+		transaction.Tags = []string{txCfg.Tags.Sync, txCfg.Tags.Payment}
+	} else {
+		transaction.ExternalID = txCfg.ExternalID(expense.ID, false)
+		transaction.Tags = []string{txCfg.Tags.Sync}
+		if net > 0 {
+			transaction.Tags = append(transaction.Tags, txCfg.Tags.Reimbursement)
+		}
+	}
+
+	var err error
+	transaction.Notes, err = txCfg.Notes(notes)
+	if err != nil {
+		return models.LunchMoneyTransaction{}, fmt.Errorf("expense %d notes: %w", expense.ID, err)
+	}
+	transaction.Notes = truncateNotes(transaction.Notes)
+
+	return transaction, nil
+}
+
+// isPayment reports whether the expense is a settle-up. Splitwise sets both
+// fields on payments; either one is enough.
+func isPayment(expense models.SplitwiseExpense) bool {
+	return expense.Payment || expense.CreationMethod == paymentCreationMethod
+}
+
+// payeeNames joins the display names of the given users, in repayment order,
+// falling back to the user ID when the expense doesn't carry a name.
+func payeeNames(expense models.SplitwiseExpense, userIDs []int64) string {
+	names := make(map[int64]string, len(expense.Users))
+	for _, u := range expense.Users {
+		id := u.UserID
+		if id == 0 {
+			id = u.User.ID
+		}
+		names[id] = strings.TrimSpace(u.User.FirstName + " " + u.User.LastName)
+	}
+
+	seen := make(map[int64]bool, len(userIDs))
+	var payees []string
+	for _, id := range userIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		name := names[id]
+		if name == "" {
+			name = fmt.Sprintf("Splitwise user %d", id)
+		}
+		payees = append(payees, name)
+	}
+
+	return strings.Join(payees, ", ")
+}
@@ -0,0 +1,496 @@
+package syncengine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jasmineyas/splitwise-lunchmoney/config"
+	"github.com/jasmineyas/splitwise-lunchmoney/models"
+)
+
+const (
+	jasmineID = 9792490
+	wesleyID  = 50086667
+	friendID  = 50043932
+)
+
+var testUsers = []models.ExpenseUser{
+	{UserID: jasmineID, User: models.User{ID: jasmineID, FirstName: "Jasmine", LastName: "Zou"}},
+	{UserID: wesleyID, User: models.User{ID: wesleyID, FirstName: "Wesley", LastName: "Finck"}},
+	{UserID: friendID, User: models.User{ID: friendID, FirstName: "Sam"}},
+}
+
+func TestTransformSWToLMTransaction(t *testing.T) {
+	userCfg := config.LunchMoneyUserConfig{BearerToken: "test-token", SplitwiseAccountAssetID: 234273}
+	date := time.Date(2025, 10, 11, 6, 58, 32, 0, time.UTC)
+	receiptURL := "https://s3.amazonaws.com/splitwise/uploads/expense/receipt/original/receipt.jpg"
+
+	tests := []struct {
+		name    string
+		expense models.SplitwiseExpense
+		userID  int64
+		want    models.LunchMoneyTransaction
+		wantErr error
+	}{
+		{
+			name: "I owe - one counterparty",
+			expense: models.SplitwiseExpense{
+				ID:          4096669090,
+				Description: "save on foods",
+				Date:        date,
+				Currency:    "CAD",
+				Repayments:  []models.Repayment{{From: jasmineID, To: wesleyID, Amount: "17.86"}},
+				Users:       testUsers,
+			},
+			userID: jasmineID,
+			want: models.LunchMoneyTransaction{
+				Date:       "2025-10-11",
+				Amount:     "-17.86",
+				Payee:      "Wesley Finck",
+				Currency:   "cad",
+				AssetID:    234273,
+				Notes:      "Expense ID: 4096669090\nOriginal expense: save on foods\nAmount owed: $17.86",
+				Status:     "uncleared",
+				ExternalID: "splitwise-4096669090",
+				Tags:       []string{"Splitwise-lunchmoney-sync"},
+			},
+		},
+		{
+			name: "I owe - N counterparties",
+			expense: models.SplitwiseExpense{
+				ID:          4096669091,
+				Description: "cabin",
+				Date:        date,
+				Currency:    "CAD",
+				Repayments: []models.Repayment{
+					{From: jasmineID, To: wesleyID, Amount: "17.86"},
+					{From: jasmineID, To: friendID, Amount: "1.8"},
+				},
+				Users: testUsers,
+			},
+			userID: jasmineID,
+			want: models.LunchMoneyTransaction{
+				Date:       "2025-10-11",
+				Amount:     "-19.66",
+				Payee:      "Wesley Finck, Sam",
+				Currency:   "cad",
+				AssetID:    234273,
+				Notes:      "Expense ID: 4096669091\nOriginal expense: cabin\nAmount owed: $19.66",
+				Status:     "uncleared",
+				ExternalID: "splitwise-4096669091",
+				Tags:       []string{"Splitwise-lunchmoney-sync"},
+			},
+		},
+		{
+			name: "they owe me - one counterparty",
+			expense: models.SplitwiseExpense{
+				ID:          4096668238,
+				Description: "save on foods",
+				Date:        date,
+				Currency:    "CAD",
+				Repayments:  []models.Repayment{{From: wesleyID, To: jasmineID, Amount: "25.46"}},
+				Users:       testUsers,
+			},
+			userID: jasmineID,
+			want: models.LunchMoneyTransaction{
+				Date:       "2025-10-11",
+				Amount:     "25.46",
+				Payee:      "Wesley Finck",
+				Currency:   "cad",
+				AssetID:    234273,
+				Notes:      "Expense ID: 4096668238\nOriginal expense: save on foods\nAmount owed to you: $25.46",
+				Status:     "uncleared",
+				ExternalID: "splitwise-4096668238",
+				Tags:       []string{"Splitwise-lunchmoney-sync", "reimbursement-placeholder"},
+			},
+		},
+		{
+			name: "they owe me - N counterparties",
+			expense: models.SplitwiseExpense{
+				ID:          4096668239,
+				Description: "groceries",
+				Date:        date,
+				Currency:    "USD",
+				Repayments: []models.Repayment{
+					{From: wesleyID, To: jasmineID, Amount: "17.86"},
+					{From: friendID, To: jasmineID, Amount: "1.86"},
+				},
+				Users: testUsers,
+			},
+			userID: jasmineID,
+			want: models.LunchMoneyTransaction{
+				Date:       "2025-10-11",
+				Amount:     "19.72",
+				Payee:      "Wesley Finck, Sam",
+				Currency:   "usd",
+				AssetID:    234273,
+				Notes:      "Expense ID: 4096668239\nOriginal expense: groceries\nAmount owed to you: $19.72",
+				Status:     "uncleared",
+				ExternalID: "splitwise-4096668239",
+				Tags:       []string{"Splitwise-lunchmoney-sync", "reimbursement-placeholder"},
+			},
+		},
+		{
+			name: "they paid me back",
+			expense: models.SplitwiseExpense{
+				ID:             4109650330,
+				Description:    "Payment",
+				Date:           date,
+				Currency:       "CAD",
+				CreationMethod: "payment",
+				Repayments:     []models.Repayment{{From: jasmineID, To: wesleyID, Amount: "50.0"}},
+				Users:          testUsers,
+			},
+			userID: jasmineID,
+			want: models.LunchMoneyTransaction{
+				Date:       "2025-10-11",
+				Amount:     "-50.00",
+				Payee:      "Wesley Finck",
+				Currency:   "cad",
+				AssetID:    234273,
+				Notes:      "Expense ID: 4109650330\nSplitwise payment",
+				Status:     "uncleared",
+				ExternalID: "splitwise-payment-4109650330",
+				Tags:       []string{"Splitwise-lunchmoney-sync", "splitwise-payment"},
+			},
+		},
+		{
+			name: "I paid them back",
+			expense: models.SplitwiseExpense{
+				ID:             4109650331,
+				Description:    "Payment",
+				Date:           date,
+				Currency:       "CAD",
+				CreationMethod: "payment",
+				Repayments:     []models.Repayment{{From: wesleyID, To: jasmineID, Amount: "50.0"}},
+				Users:          testUsers,
+			},
+			userID: jasmineID,
+			want: models.LunchMoneyTransaction{
+				Date:       "2025-10-11",
+				Amount:     "50.00",
+				Payee:      "Wesley Finck",
+				Currency:   "cad",
+				AssetID:    234273,
+				Notes:      "Expense ID: 4109650331\nSplitwise payment",
+				Status:     "uncleared",
+				ExternalID: "splitwise-payment-4109650331",
+				Tags:       []string{"Splitwise-lunchmoney-sync", "splitwise-payment"},
+			},
+		},
+		{
+			name: "payment flag without creation method",
+			expense: models.SplitwiseExpense{
+				ID:          4109650332,
+				Description: "Payment",
+				Date:        date,
+				Currency:    "CAD",
+				Payment:     true,
+				Repayments:  []models.Repayment{{From: jasmineID, To: wesleyID, Amount: "12.5"}},
+				Users:       testUsers,
+			},
+			userID: wesleyID,
+			want: models.LunchMoneyTransaction{
+				Date:       "2025-10-11",
+				Amount:     "12.50",
+				Payee:      "Jasmine Zou",
+				Currency:   "cad",
+				AssetID:    234273,
+				Notes:      "Expense ID: 4109650332\nSplitwise payment",
+				Status:     "uncleared",
+				ExternalID: "splitwise-payment-4109650332",
+				Tags:       []string{"Splitwise-lunchmoney-sync", "splitwise-payment"},
+			},
+		},
+		{
+			name: "receipt link in notes",
+			expense: models.SplitwiseExpense{
+				ID:          4096669092,
+				Description: "save on foods",
+				Date:        date,
+				Currency:    "CAD",
+				Receipt:     models.Receipt{Original: &receiptURL},
+				Repayments:  []models.Repayment{{From: jasmineID, To: wesleyID, Amount: "17.86"}},
+				Users:       testUsers,
+			},
+			userID: jasmineID,
+			want: models.LunchMoneyTransaction{
+				Date:       "2025-10-11",
+				Amount:     "-17.86",
+				Payee:      "Wesley Finck",
+				Currency:   "cad",
+				AssetID:    234273,
+				Notes:      "Expense ID: 4096669092\nOriginal expense: save on foods\nAmount owed: $17.86\n[Receipt: https://s3.amazonaws.com/splitwise/uploads/expense/receipt/original/receipt.jpg]",
+				Status:     "uncleared",
+				ExternalID: "splitwise-4096669092",
+				Tags:       []string{"Splitwise-lunchmoney-sync"},
+			},
+		},
+		{
+			name: "payment receipt link in notes",
+			expense: models.SplitwiseExpense{
+				ID:             4109650333,
+				Description:    "Payment",
+				Date:           date,
+				Currency:       "CAD",
+				CreationMethod: "payment",
+				Receipt:        models.Receipt{Original: &receiptURL},
+				Repayments:     []models.Repayment{{From: jasmineID, To: wesleyID, Amount: "50.0"}},
+				Users:          testUsers,
+			},
+			userID: jasmineID,
+			want: models.LunchMoneyTransaction{
+				Date:       "2025-10-11",
+				Amount:     "-50.00",
+				Payee:      "Wesley Finck",
+				Currency:   "cad",
+				AssetID:    234273,
+				Notes:      "Expense ID: 4109650333\nSplitwise payment\n[Receipt: https://s3.amazonaws.com/splitwise/uploads/expense/receipt/original/receipt.jpg]",
+				Status:     "uncleared",
+				ExternalID: "splitwise-payment-4109650333",
+				Tags:       []string{"Splitwise-lunchmoney-sync", "splitwise-payment"},
+			},
+		},
+		{
+			name: "other user's perspective flips the sign",
+			expense: models.SplitwiseExpense{
+				ID:          4096669090,
+				Description: "save on foods",
+				Date:        date,
+				Currency:    "CAD",
+				Repayments:  []models.Repayment{{From: jasmineID, To: wesleyID, Amount: "17.86"}},
+				Users:       testUsers,
+			},
+			userID: wesleyID,
+			want: models.LunchMoneyTransaction{
+				Date:       "2025-10-11",
+				Amount:     "17.86",
+				Payee:      "Jasmine Zou",
+				Currency:   "cad",
+				AssetID:    234273,
+				Notes:      "Expense ID: 4096669090\nOriginal expense: save on foods\nAmount owed to you: $17.86",
+				Status:     "uncleared",
+				ExternalID: "splitwise-4096669090",
+				Tags:       []string{"Splitwise-lunchmoney-sync", "reimbursement-placeholder"},
+			},
+		},
+		{
+			name: "unknown counterparty name falls back to ID",
+			expense: models.SplitwiseExpense{
+				ID:         1,
+				Date:       date,
+				Currency:   "CAD",
+				Repayments: []models.Repayment{{From: jasmineID, To: 42, Amount: "5"}},
+			},
+			userID: jasmineID,
+			want: models.LunchMoneyTransaction{
+				Date:       "2025-10-11",
+				Amount:     "-5.00",
+				Payee:      "Splitwise user 42",
+				Currency:   "cad",
+				AssetID:    234273,
+				Notes:      "Expense ID: 1\nOriginal expense: \nAmount owed: $5.00",
+				Status:     "uncleared",
+				ExternalID: "splitwise-1",
+				Tags:       []string{"Splitwise-lunchmoney-sync"},
+			},
+		},
+		{
+			name: "user not in any repayment",
+			expense: models.SplitwiseExpense{
+				ID:         2,
+				Date:       date,
+				Repayments: []models.Repayment{{From: wesleyID, To: friendID, Amount: "5"}},
+			},
+			userID:  jasmineID,
+			wantErr: ErrNothingOwed,
+		},
+		{
+			name: "no repayments",
+			expense: models.SplitwiseExpense{
+				ID:   3,
+				Date: date,
+			},
+			userID:  jasmineID,
+			wantErr: ErrNothingOwed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := TransformSWToLMTransaction(tt.expense, tt.userID, userCfg, config.DefaultTransactionConfig(false))
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("TransformSWToLMTransaction() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("TransformSWToLMTransaction() unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TransformSWToLMTransaction() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransformSettleUpCancelsExpense(t *testing.T) {
+	date := time.Date(2025, 10, 11, 6, 58, 32, 0, time.UTC)
+	// Wesley owes Jasmine for dinner...
+	dinner := models.SplitwiseExpense{
+		ID:          4096669090,
+		Description: "dinner",
+		Date:        date,
+		Currency:    "CAD",
+		Repayments:  []models.Repayment{{From: wesleyID, To: jasmineID, Amount: "17.86"}},
+		Users:       testUsers,
+	}
+	// ...then pays her back. As in get_expenses, the sender paid the payment
+	// and the receiver owes it, so the repayment runs from Jasmine to Wesley.
+	payment := models.SplitwiseExpense{
+		ID:             4109650330,
+		Description:    "Payment",
+		Date:           date.AddDate(0, 0, 1),
+		Currency:       "CAD",
+		Payment:        true,
+		CreationMethod: "payment",
+		Repayments:     []models.Repayment{{From: jasmineID, To: wesleyID, Amount: "17.86"}},
+		Users: []models.ExpenseUser{
+			{UserID: wesleyID, User: models.User{ID: wesleyID, FirstName: "Wesley", LastName: "Finck"}, PaidShare: "17.86", OwedShare: "0.0", NetBalance: "17.86"},
+			{UserID: jasmineID, User: models.User{ID: jasmineID, FirstName: "Jasmine", LastName: "Zou"}, PaidShare: "0.0", OwedShare: "17.86", NetBalance: "-17.86"},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		userID      int64
+		wantExpense string
+		wantPayment string
+	}{
+		{name: "receiver", userID: jasmineID, wantExpense: "17.86", wantPayment: "-17.86"},
+		{name: "sender", userID: wesleyID, wantExpense: "-17.86", wantPayment: "17.86"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var balance int64
+			for _, c := range []struct {
+				expense models.SplitwiseExpense
+				want    string
+			}{{dinner, tt.wantExpense}, {payment, tt.wantPayment}} {
+				transaction, err := TransformSWToLMTransaction(c.expense, tt.userID, config.LunchMoneyUserConfig{}, config.DefaultTransactionConfig(false))
+				if err != nil {
+					t.Fatalf("TransformSWToLMTransaction(%d) error = %v", c.expense.ID, err)
+				}
+				if transaction.Amount != c.want {
+					t.Errorf("expense %d amount = %s, want %s", c.expense.ID, transaction.Amount, c.want)
+				}
+				cents, _ := models.ParseCents(transaction.Amount)
+				balance += cents
+			}
+
+			if balance != 0 {
+				t.Errorf("balance after settling up = %s, want 0.00", models.FormatCents(balance))
+			}
+		})
+	}
+}
+
+func TestTransformSWToLMTransactionInvalidAmount(t *testing.T) {
+	expense := models.SplitwiseExpense{
+		ID:         4,
+		Repayments: []models.Repayment{{From: jasmineID, To: wesleyID, Amount: "abc"}},
+	}
+
+	if _, err := TransformSWToLMTransaction(expense, jasmineID, config.LunchMoneyUserConfig{}, config.DefaultTransactionConfig(false)); err == nil {
+		t.Error("expected error for invalid repayment amount, got nil")
+	}
+}
+
+func TestTransformSWToLMTransactionCustomConfig(t *testing.T) {
+	txCfg := config.TransactionConfig{
+		Status:        config.StatusCleared,
+		NotesTemplate: `{{if .OwedToYou}}+{{else}}-{{end}}{{.Amount}} {{.Currency}} for {{.Description}} (#{{.ExpenseID}})`,
+		Tags:          config.TagConfig{Sync: "sw", Reimbursement: "owed-to-me", Payment: "settle-up", Deleted: "gone"},
+	}
+	expense := models.SplitwiseExpense{
+		ID:          7,
+		Description: "dinner",
+		Currency:    "CAD",
+		Date:        time.Date(2025, 10, 11, 0, 0, 0, 0, time.UTC),
+		Users:       testUsers,
+		Repayments:  []models.Repayment{{From: wesleyID, To: jasmineID, Amount: "12.50"}},
+	}
+
+	got, err := TransformSWToLMTransaction(expense, jasmineID, config.LunchMoneyUserConfig{SplitwiseAccountAssetID: 111}, txCfg)
+	if err != nil {
+		t.Fatalf("TransformSWToLMTransaction() unexpected error: %v", err)
+	}
+
+	if got.Status != config.StatusCleared {
+		t.Errorf("Status = %q, want %q", got.Status, config.StatusCleared)
+	}
+	if wantTags := []string{"sw", "owed-to-me"}; !reflect.DeepEqual(got.Tags, wantTags) {
+		t.Errorf("Tags = %v, want %v", got.Tags, wantTags)
+	}
+	if wantNotes := "+12.50 cad for dinner (#7)"; got.Notes != wantNotes {
+		t.Errorf("Notes = %q, want %q", got.Notes, wantNotes)
+	}
+
+	txCfg.NotesTemplate = "{{.NoSuchField}}"
+	if _, err := TransformSWToLMTransaction(expense, jasmineID, config.LunchMoneyUserConfig{}, txCfg); err == nil {
+		t.Error("expected error for a notes template using an unknown field, got nil")
+	}
+}
+
+func TestTransformSWToLMTransactionTestMode(t *testing.T) {
+	date := time.Date(2025, 10, 11, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name           string
+		expense        models.SplitwiseExpense
+		wantExternalID string
+		wantTags       []string
+	}{
+		{
+			name: "expense",
+			expense: models.SplitwiseExpense{
+				ID: 4096669090, Description: "save on foods", Currency: "CAD", Date: date, Users: testUsers,
+				Repayments: []models.Repayment{{From: jasmineID, To: wesleyID, Amount: "17.86"}},
+			},
+			wantExternalID: "splitwise-4096669090-test",
+			wantTags:       []string{"Splitwise-lunchmoney-sync-test"},
+		},
+		{
+			name: "payment",
+			expense: models.SplitwiseExpense{
+				ID: 4109650330, Description: "Payment", Currency: "CAD", Date: date, Users: testUsers,
+				Payment: true, CreationMethod: "payment",
+				Repayments: []models.Repayment{{From: wesleyID, To: jasmineID, Amount: "50.0"}},
+			},
+			wantExternalID: "splitwise-payment-4109650330-test",
+			wantTags:       []string{"Splitwise-lunchmoney-sync-test", "splitwise-payment-test"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := TransformSWToLMTransaction(tt.expense, jasmineID, config.LunchMoneyUserConfig{SplitwiseAccountAssetID: 111}, config.DefaultTransactionConfig(true))
+			if err != nil {
+				t.Fatalf("TransformSWToLMTransaction() unexpected error: %v", err)
+			}
+			// a test run must not collide with the production transaction
+			// in the same asset
+			if got.ExternalID != tt.wantExternalID {
+				t.Errorf("ExternalID = %q, want %q", got.ExternalID, tt.wantExternalID)
+			}
+			if !reflect.DeepEqual(got.Tags, tt.wantTags) {
+				t.Errorf("Tags = %v, want %v", got.Tags, tt.wantTags)
+			}
+		})
+	}
+}